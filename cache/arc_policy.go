@@ -0,0 +1,132 @@
+package cache
+
+import "container/list"
+
+// arcPolicy is the adaptive replacement cache:
+// t1 holds the keys seen once recently, t2 holds the keys seen at least twice,
+// b1 and b2 are the ghost lists of the keys evicted from t1 and t2, and p is
+// the adaptive target size of t1
+type arcPolicy struct {
+	capacity int
+	p        int
+	t1, t2   *list.List
+	b1, b2   *ghostList
+	// the last added key was found in b2, prefer to evict from t1
+	hitB2 bool
+}
+
+func newARCPolicy(capacity int) *arcPolicy {
+	return &arcPolicy{
+		capacity: capacity,
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       newGhostList(capacity),
+		b2:       newGhostList(capacity),
+	}
+}
+
+func (p *arcPolicy) add(entry *listEntry) {
+	p.hitB2 = false
+	switch {
+	case p.b1.remove(entry.key):
+		// recently evicted from t1, grow t1
+		p.p = min(p.capacity, p.p+max(p.b2.len()/max(p.b1.len(), 1), 1))
+		p.pushFront(p.t2, segT2, entry)
+	case p.b2.remove(entry.key):
+		// recently evicted from t2, shrink t1
+		p.p = max(0, p.p-max(p.b1.len()/max(p.b2.len(), 1), 1))
+		p.hitB2 = true
+		p.pushFront(p.t2, segT2, entry)
+	default:
+		p.pushFront(p.t1, segT1, entry)
+	}
+}
+
+func (p *arcPolicy) access(entry *listEntry) {
+	p.unlink(entry)
+	p.pushFront(p.t2, segT2, entry)
+}
+
+func (p *arcPolicy) remove(entry *listEntry) {
+	p.unlink(entry)
+}
+
+// victim is the REPLACE of ARC, which runs before the added entry is
+// inserted, so the added one is not counted in its list
+func (p *arcPolicy) victim(added *listEntry) *listEntry {
+	t1Len, t2Len := p.t1.Len(), p.t2.Len()
+	switch added.seg {
+	case segT1:
+		t1Len--
+	case segT2:
+		t2Len--
+	}
+	if t1Len > 0 && (t1Len > p.p || (p.hitB2 && t1Len == p.p) || t2Len == 0) {
+		entry := backExcept(p.t1, added)
+		p.b1.push(entry.key)
+		return entry
+	}
+	if entry := backExcept(p.t2, added); entry != nil {
+		p.b2.push(entry.key)
+		return entry
+	}
+	return nil
+}
+
+func (p *arcPolicy) entries() []*listEntry {
+	return appendBackward(appendBackward(nil, p.t1), p.t2)
+}
+
+func (p *arcPolicy) pushFront(lst *list.List, seg segment, entry *listEntry) {
+	entry.seg = seg
+	entry.elem = lst.PushFront(entry)
+}
+
+func (p *arcPolicy) unlink(entry *listEntry) {
+	switch entry.seg {
+	case segT1:
+		p.t1.Remove(entry.elem)
+	case segT2:
+		p.t2.Remove(entry.elem)
+	}
+	entry.seg = segNone
+}
+
+// ghostList is a bounded lru list of the evicted keys
+type ghostList struct {
+	capacity int
+	lst      *list.List
+	hash     map[Key]*list.Element
+}
+
+func newGhostList(capacity int) *ghostList {
+	return &ghostList{
+		capacity: capacity,
+		lst:      list.New(),
+		hash:     map[Key]*list.Element{},
+	}
+}
+
+func (g *ghostList) len() int {
+	return g.lst.Len()
+}
+
+func (g *ghostList) push(key Key) {
+	if elem, exists := g.hash[key]; exists {
+		g.lst.MoveToFront(elem)
+		return
+	}
+	g.hash[key] = g.lst.PushFront(key)
+	if g.lst.Len() > g.capacity {
+		g.remove(g.lst.Back().Value)
+	}
+}
+
+func (g *ghostList) remove(key Key) bool {
+	if elem, exists := g.hash[key]; exists {
+		g.lst.Remove(elem)
+		delete(g.hash, key)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+// Package broadcast propagates the cache invalidations between the instances
+// of a service through etcd
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/leopoldxx/go-utils/cache"
+	"github.com/leopoldxx/go-utils/trace"
+	"github.com/nu7hatch/gouuid"
+)
+
+const (
+	defaultPrefix   = "/go-utils/cache/invalidation"
+	defaultEventTTL = 10 * time.Second
+	retryInterval   = time.Second
+)
+
+const (
+	opDel           = "del"
+	opInvalidateTag = "invalidate-tag"
+)
+
+// Options config Broadcaster
+type Options func(opt *options)
+
+// WithPrefix sets the etcd key prefix of the invalidation events, the
+// instances sharing one cache should use the same prefix
+func WithPrefix(prefix string) Options {
+	return func(opt *options) {
+		opt.prefix = prefix
+	}
+}
+
+// WithEventTTL sets the ttl of the lease of the published events, they are
+// removed by etcd once the instance stops or fails to keep the lease alive
+func WithEventTTL(ttl time.Duration) Options {
+	return func(opt *options) {
+		opt.eventTTL = ttl
+	}
+}
+
+type options struct {
+	prefix   string
+	eventTTL time.Duration
+}
+
+type event struct {
+	Origin string `json:"origin"`
+	Op     string `json:"op"`
+	Key    string `json:"key,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+}
+
+// Broadcaster applies the invalidations to the local cache and publishes them
+// to etcd, and applies the invalidations published by the other instances
+type Broadcaster struct {
+	cli   *clientv3.Client
+	cache cache.Cache
+	opts  options
+	id    string
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// the lease shared by all the published events
+	leaseMu     sync.Mutex
+	lease       clientv3.LeaseID
+	leaseCancel context.CancelFunc
+}
+
+// New will create a Broadcaster for the local cache, the keys of the cache
+// must be strings
+func New(cli *clientv3.Client, c cache.Cache, opts ...Options) *Broadcaster {
+	ops := options{prefix: defaultPrefix, eventTTL: defaultEventTTL}
+	for _, opt := range opts {
+		opt(&ops)
+	}
+
+	id := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if uid, err := uuid.NewV4(); err == nil {
+		id = uid.String()
+	}
+	return &Broadcaster{
+		cli:   cli,
+		cache: c,
+		opts:  ops,
+		id:    id,
+	}
+}
+
+// Start watching the invalidations of the other instances until Stop is called
+func (b *Broadcaster) Start(ctx context.Context) error {
+	if b == nil {
+		return errors.New("nil broadcaster")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		return errors.New("broadcaster is already started")
+	}
+	ctx, b.cancel = context.WithCancel(ctx)
+	b.done = make(chan struct{})
+
+	// watch from the current revision, so no event is lost once Start returns
+	resp, err := b.cli.Get(ctx, b.opts.prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		b.cancel()
+		b.cancel = nil
+		return err
+	}
+	go b.watch(ctx, resp.Header.Revision+1)
+	return nil
+}
+
+// Stop watching, and revoke the lease of the published events
+func (b *Broadcaster) Stop() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.revoke()
+	if b.cancel == nil {
+		return
+	}
+	b.cancel()
+	<-b.done
+	b.cancel = nil
+}
+
+// Del the key of the local cache, and of the other instances
+func (b *Broadcaster) Del(ctx context.Context, key string) error {
+	b.cache.Del(key)
+	return b.publish(ctx, event{Op: opDel, Key: key})
+}
+
+// InvalidateTag of the local cache, and of the other instances
+func (b *Broadcaster) InvalidateTag(ctx context.Context, tag string) error {
+	b.cache.InvalidateTag(tag)
+	return b.publish(ctx, event{Op: opInvalidateTag, Tag: tag})
+}
+
+func (b *Broadcaster) publish(ctx context.Context, ev event) error {
+	ev.Origin = b.id
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	lease, err := b.grant(ctx)
+	if err != nil {
+		return err
+	}
+	// the watchers receive every revision of the key, so one key per
+	// instance is enough and the events never pile up in etcd
+	_, err = b.cli.Put(ctx, b.opts.prefix+"/"+b.id, string(data), clientv3.WithLease(lease))
+	return err
+}
+
+// grant returns the kept-alive lease, a new one is granted if there is none
+func (b *Broadcaster) grant(ctx context.Context) (clientv3.LeaseID, error) {
+	b.leaseMu.Lock()
+	defer b.leaseMu.Unlock()
+	if b.lease != clientv3.NoLease {
+		return b.lease, nil
+	}
+
+	ttl := int64(b.opts.eventTTL / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	resp, err := b.cli.Grant(ctx, ttl)
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+	kctx, cancel := context.WithCancel(context.Background())
+	ch, err := b.cli.KeepAlive(kctx, resp.ID)
+	if err != nil {
+		cancel()
+		return clientv3.NoLease, err
+	}
+	b.lease, b.leaseCancel = resp.ID, cancel
+
+	go func() {
+		for range ch {
+		}
+		// the lease is expired or revoked, the next event grants a new one
+		b.leaseMu.Lock()
+		if b.lease == resp.ID {
+			b.lease, b.leaseCancel = clientv3.NoLease, nil
+		}
+		b.leaseMu.Unlock()
+		cancel()
+	}()
+	return resp.ID, nil
+}
+
+func (b *Broadcaster) revoke() {
+	b.leaseMu.Lock()
+	lease, cancel := b.lease, b.leaseCancel
+	b.lease, b.leaseCancel = clientv3.NoLease, nil
+	b.leaseMu.Unlock()
+	if lease == clientv3.NoLease {
+		return
+	}
+	cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), retryInterval)
+	defer cancel()
+	if _, err := b.cli.Revoke(ctx, lease); err != nil {
+		trace.GetTraceFromContext(ctx).Warnf("event=[cache-invalidation-revoke-failed] lease=[%x] err=[%v]", lease, err)
+	}
+}
+
+func (b *Broadcaster) watch(ctx context.Context, rev int64) {
+	defer close(b.done)
+	tracer := trace.GetTraceFromContext(ctx)
+	for {
+		wch := b.cli.Watch(clientv3.WithRequireLeader(ctx), b.opts.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev))
+		for resp := range wch {
+			if err := resp.Err(); err != nil {
+				tracer.Warnf("event=[cache-invalidation-watch-failed] prefix=[%s] err=[%v]", b.opts.prefix, err)
+				if resp.CompactRevision > rev {
+					rev = resp.CompactRevision
+				}
+				break
+			}
+			for _, ev := range resp.Events {
+				if ev.Type == clientv3.EventTypePut {
+					b.apply(tracer, ev.Kv.Value)
+				}
+			}
+			rev = resp.Header.Revision + 1
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (b *Broadcaster) apply(tracer trace.Trace, data []byte) {
+	var ev event
+	if err := json.Unmarshal(data, &ev); err != nil {
+		tracer.Warnf("event=[cache-invalidation-invalid] data=[%s] err=[%v]", data, err)
+		return
+	}
+	// already applied to the local cache
+	if ev.Origin == b.id {
+		return
+	}
+	switch ev.Op {
+	case opDel:
+		b.cache.Del(ev.Key)
+	case opInvalidateTag:
+		b.cache.InvalidateTag(ev.Tag)
+	}
+}
@@ -0,0 +1,111 @@
+package broadcast
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+	"github.com/coreos/etcd/etcdserver/api/v3client"
+	"github.com/leopoldxx/go-utils/cache"
+)
+
+// freeURL returns the url of a free local port
+func freeURL(t *testing.T) *url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen on a free port failed:", err)
+	}
+	defer l.Close()
+	return &url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+func startEtcd(t *testing.T) *embed.Etcd {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.LCUrls, cfg.ACUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal("start embedded etcd failed:", err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Close()
+		t.Fatal("embedded etcd is not ready")
+	}
+	return e
+}
+
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	e := startEtcd(t)
+	defer e.Close()
+	cli := v3client.New(e.Server)
+	defer cli.Close()
+
+	ctx := context.Background()
+	local, remote := cache.NewCache(), cache.NewCache()
+	defer local.Close()
+	defer remote.Close()
+
+	lb := New(cli, local, WithPrefix("/test/cache"))
+	rb := New(cli, remote, WithPrefix("/test/cache"))
+	for _, b := range []*Broadcaster{lb, rb} {
+		if err := b.Start(ctx); err != nil {
+			t.Fatal("start broadcaster failed:", err)
+		}
+		defer b.Stop()
+	}
+
+	for _, c := range []cache.Cache{local, remote} {
+		c.Put("testkey1", "testvalue1")
+		c.PutWithTags("testkey2", "testvalue2", time.Minute, "testtag")
+		c.PutWithTags("testkey3", "testvalue3", time.Minute, "testtag")
+	}
+
+	if err := lb.Del(ctx, "testkey1"); err != nil {
+		t.Fatal("del testkey1 failed:", err)
+	}
+	if _, ok := local.Get("testkey1"); ok {
+		t.Fatal("testkey1 should be deleted from the local cache at once")
+	}
+	waitFor(t, "testkey1 should be deleted from the remote cache", func() bool {
+		_, ok := remote.Peek("testkey1")
+		return !ok
+	})
+
+	if err := rb.InvalidateTag(ctx, "testtag"); err != nil {
+		t.Fatal("invalidate testtag failed:", err)
+	}
+	waitFor(t, "testtag should be invalidated in the local cache", func() bool {
+		return local.Len() == 0
+	})
+	if remote.Len() != 0 {
+		t.Fatalf("testtag should be invalidated in the remote cache, len %d", remote.Len())
+	}
+
+	// the events of one instance share a lease
+	if err := lb.Del(ctx, "testkey4"); err != nil {
+		t.Fatal("del testkey4 failed:", err)
+	}
+	resp, err := cli.Leases(ctx)
+	if err != nil || len(resp.Leases) != 2 {
+		t.Fatalf("leases failed, expect 2, got %v, %v", resp, err)
+	}
+}
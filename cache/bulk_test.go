@@ -0,0 +1,108 @@
+package cache_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	. "github.com/leopoldxx/go-utils/cache"
+)
+
+func TestBulk(t *testing.T) {
+	for _, shards := range []int{0, 4} {
+		cache := NewCacheWithConfig(Config{MaxLen: 100, Shards: shards})
+
+		cache.PutMulti(map[Key]Value{"testkey1": "testvalue1", "testkey2": "testvalue2", "testkey3": "testvalue3"})
+		values := cache.GetMulti([]Key{"testkey1", "testkey2", "testkey4"})
+		if len(values) != 2 || values["testkey1"] != "testvalue1" || values["testkey2"] != "testvalue2" {
+			t.Fatalf("get multi of shards %d failed, got %v", shards, values)
+		}
+
+		deleted := cache.DelMulti([]Key{"testkey1", "testkey4"})
+		if len(deleted) != 1 || deleted["testkey1"] != "testvalue1" {
+			t.Fatalf("del multi of shards %d failed, got %v", shards, deleted)
+		}
+		if cache.Len() != 2 {
+			t.Fatalf("len of shards %d failed, expect 2, got %d", shards, cache.Len())
+		}
+
+		cache.PutWithTimeout("testkey5", "testvalue5", time.Second)
+		time.Sleep(time.Second + 100*time.Millisecond)
+
+		var keys []string
+		for _, key := range cache.Keys() {
+			keys = append(keys, key.(string))
+		}
+		sort.Strings(keys)
+		if len(keys) != 2 || keys[0] != "testkey2" || keys[1] != "testkey3" {
+			t.Fatalf("keys of shards %d failed, got %v", shards, keys)
+		}
+
+		ranged := map[Key]Value{}
+		cache.Range(func(key Key, value Value) bool {
+			ranged[key] = value
+			// the cache can be accessed in the range func
+			cache.Peek(key)
+			return true
+		})
+		if len(ranged) != 2 || ranged["testkey2"] != "testvalue2" {
+			t.Fatalf("range of shards %d failed, got %v", shards, ranged)
+		}
+
+		n := 0
+		cache.Range(func(key Key, value Value) bool {
+			n++
+			return false
+		})
+		if n != 1 {
+			t.Fatalf("range stop of shards %d failed, got %d", shards, n)
+		}
+		cache.Close()
+	}
+}
+
+func TestPeek(t *testing.T) {
+	cache := NewCacheWithConfig(Config{MaxLen: 2})
+	defer cache.Close()
+
+	cache.Put("testkey1", "testvalue1")
+	cache.Put("testkey2", "testvalue2")
+	// peek does not promote testkey1
+	if v, ok := cache.Peek("testkey1"); !ok || v != "testvalue1" {
+		t.Fatalf("peek testkey1 failed, got %v, %v", v, ok)
+	}
+	cache.Put("testkey3", "testvalue3")
+	if _, ok := cache.Peek("testkey1"); ok {
+		t.Fatalf("testkey1 should be evicted")
+	}
+	if s := cache.Stats(); s.Hits != 0 || s.Misses != 0 {
+		t.Fatalf("peek should not be counted, got %+v", s)
+	}
+}
+
+func TestTypedBulk(t *testing.T) {
+	cache := NewTypedWithConfig[string, int](Config{MaxLen: 10})
+	defer cache.Close()
+
+	cache.PutMulti(map[string]int{"one": 1, "two": 2, "three": 3})
+	if values := cache.GetMulti([]string{"one", "two", "four"}); len(values) != 2 || values["two"] != 2 {
+		t.Fatalf("get multi failed, got %v", values)
+	}
+	if deleted := cache.DelMulti([]string{"one"}); deleted["one"] != 1 {
+		t.Fatalf("del multi failed, got %v", deleted)
+	}
+	if v, ok := cache.Peek("three"); !ok || v != 3 {
+		t.Fatalf("peek failed, got %v, %v", v, ok)
+	}
+	if keys := cache.Keys(); len(keys) != 2 {
+		t.Fatalf("keys failed, got %v", keys)
+	}
+	sum := 0
+	cache.Range(func(key string, value int) bool {
+		sum += value
+		return true
+	})
+	if sum != 5 {
+		t.Fatalf("range failed, expect 5, got %d", sum)
+	}
+}
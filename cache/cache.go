@@ -12,8 +12,22 @@ type Value interface{}
 type Cache interface {
 	Put(key Key, value Value)
 	PutWithTimeout(key Key, value Value, t time.Duration)
+	// PutWithTags puts the value with the tags, which can be invalidated
+	// together by InvalidateTag
+	PutWithTags(key Key, value Value, t time.Duration, tags ...string)
+	InvalidateTag(tag string) int
 	Get(key Key) (Value, bool)
 	Del(key Key) Value
+	// GetMulti, PutMulti & DelMulti take the lock once per batch
+	GetMulti(keys []Key) map[Key]Value
+	PutMulti(values map[Key]Value)
+	DelMulti(keys []Key) map[Key]Value
+	// Peek reads the value without promoting or extending it
+	Peek(key Key) (Value, bool)
+	// Keys & Range skip the expired keys
+	Keys() []Key
+	Range(f func(key Key, value Value) bool)
 	Len() int
+	Stats() Stats
 	Close()
 }
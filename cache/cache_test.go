@@ -1,6 +1,7 @@
 package cache_test
 
 import (
+	"sync"
 	"testing"
 	"time"
 
@@ -236,3 +237,117 @@ func TestCacheTime(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheCleanup(t *testing.T) {
+	var mu sync.Mutex
+	evicted := map[Key]Value{}
+	cb := func(key Key, value Value) {
+		mu.Lock()
+		defer mu.Unlock()
+		evicted[key] = value
+	}
+
+	cache := NewCacheWithConfig(Config{MaxLen: 10, Callback: cb, CleanupInterval: 100 * time.Millisecond})
+
+	cache.PutWithTimeout("testkey1", "testvalue1", time.Second)
+	cache.PutWithTimeout("testkey2", "testvalue2", time.Minute)
+	time.Sleep(time.Second + 300*time.Millisecond)
+
+	// the expired key should be removed without any Get
+	if cache.Len() != 1 {
+		t.Fatalf("len failed, expect 1, got %d", cache.Len())
+	}
+	mu.Lock()
+	if evicted["testkey1"] != "testvalue1" {
+		t.Fatalf("callback of testkey1 failed, got %v", evicted)
+	}
+	mu.Unlock()
+
+	// close will notify all the remaining keys
+	cache.Close()
+	if cache.Len() != 0 {
+		t.Fatalf("len failed, expect 0, got %d", cache.Len())
+	}
+	mu.Lock()
+	if evicted["testkey2"] != "testvalue2" {
+		t.Fatalf("callback of testkey2 failed, got %v", evicted)
+	}
+	mu.Unlock()
+	cache.Close()
+}
+
+func TestCacheEvictReason(t *testing.T) {
+	reasons := map[Key]EvictReason{}
+	cb := func(key Key, value Value, reason EvictReason) {
+		t.Log(key, value, reason)
+		reasons[key] = reason
+	}
+
+	cache := NewCacheWithConfig(Config{MaxLen: 2, ReasonCallback: cb})
+
+	cache.Put("testkey1", "testvalue1")
+	cache.Put("testkey2", "testvalue2")
+	cache.Put("testkey3", "testvalue3")
+	cache.Del("testkey2")
+	cache.PutWithTimeout("testkey4", "testvalue4", time.Second)
+	time.Sleep(time.Second + 100*time.Millisecond)
+	cache.Get("testkey4")
+	cache.Close()
+
+	expects := map[Key]EvictReason{
+		"testkey1": EvictCapacity,
+		"testkey2": EvictDeleted,
+		"testkey3": EvictClosed,
+		"testkey4": EvictExpired,
+	}
+	for key, reason := range expects {
+		if got, ok := reasons[key]; !ok || got != reason {
+			t.Fatalf("test key %s reason failed, expect %v, got %v", key, reason, got)
+		}
+	}
+}
+
+func TestCacheCost(t *testing.T) {
+	reasons := map[Key]EvictReason{}
+	cb := func(key Key, value Value, reason EvictReason) {
+		reasons[key] = reason
+	}
+	cost := func(key Key, value Value) int64 {
+		return int64(len(value.(string)))
+	}
+	cache := NewCacheWithConfig(Config{MaxCost: 10, Cost: cost, ReasonCallback: cb})
+	defer cache.Close()
+
+	testCases := []struct {
+		key        string
+		value      string
+		expectLen  int
+		expectCost int64
+	}{
+		{"testkey1", "1234", 1, 4},
+		{"testkey2", "1234", 2, 8},
+		// testkey1 is evicted to fit the cost
+		{"testkey3", "1234", 2, 8},
+		// testkey2 & testkey3 are evicted
+		{"testkey4", "123456789", 1, 9},
+		// the update of testkey4 only changes the cost
+		{"testkey4", "1", 1, 1},
+		// the value costs more than the budget
+		{"testkey5", "12345678901", 1, 1},
+	}
+	for _, tc := range testCases {
+		cache.Put(tc.key, tc.value)
+		s := cache.Stats()
+		if s.Len != tc.expectLen || s.Cost != tc.expectCost {
+			t.Fatalf("test key %s failed, expect len %d cost %d, got len %d cost %d", tc.key, tc.expectLen, tc.expectCost, s.Len, s.Cost)
+		}
+	}
+	for _, key := range []string{"testkey1", "testkey2", "testkey3", "testkey5"} {
+		if reasons[key] != EvictCapacity {
+			t.Fatalf("test key %s should be evicted, got %v", key, reasons)
+		}
+	}
+	if v, ok := cache.Get("testkey4"); !ok || v != "1" {
+		t.Fatalf("get testkey4 failed, got %v, %v", v, ok)
+	}
+}
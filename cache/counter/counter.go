@@ -1,6 +1,9 @@
 package counter
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+	"time"
+)
 
 type count struct {
 	hit  int64
@@ -19,12 +22,15 @@ func (c *count) value() (int64, int64) {
 	return atomic.LoadInt64(&c.hit), atomic.LoadInt64(&c.miss)
 }
 
+// Counter is a sliding window hit/miss counter, the window is made up of
+// groups, and Advance drops the oldest group
 type Counter struct {
 	counts []count
 	total  count
 	idx    int32
 }
 
+// New creates a counter with the number of groups
 func New(group uint16) *Counter {
 	return &Counter{
 		counts: make([]count, group),
@@ -34,6 +40,8 @@ func New(group uint16) *Counter {
 func (counter *Counter) currentIdx() int32 {
 	return atomic.LoadInt32(&counter.idx)
 }
+
+// Advance the window by one group
 func (counter *Counter) Advance() (int32, bool) {
 	idx := atomic.LoadInt32(&counter.idx)
 	nextIdx := (idx + 1) % int32(len(counter.counts))
@@ -54,18 +62,40 @@ func (counter *Counter) Advance() (int32, bool) {
 	}
 	return idx, false
 }
+
+// AutoAdvance will advance the window every interval in the background until
+// the stop chan is closed
+func (counter *Counter) AutoAdvance(interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				counter.Advance()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Hit count
 func (counter *Counter) Hit() {
 	idx := atomic.LoadInt32(&counter.idx)
 	(&counter.counts[idx]).h(1)
 	(&counter.total).h(1)
 }
+
+// Miss count
 func (counter *Counter) Miss() {
 	idx := atomic.LoadInt32(&counter.idx)
 	(&counter.counts[idx]).m(1)
 	(&counter.total).m(1)
 }
 
-func (counter *Counter) snapshot() ([]int64, []int64, int64, int64) {
+// Snapshot returns the hits & misses of every group, and the totals of the window
+func (counter *Counter) Snapshot() ([]int64, []int64, int64, int64) {
 	hit := make([]int64, len(counter.counts))
 	miss := make([]int64, len(counter.counts))
 	for idx := 0; idx < len(counter.counts); idx++ {
@@ -74,6 +104,8 @@ func (counter *Counter) snapshot() ([]int64, []int64, int64, int64) {
 	hitTotal, missTotal := counter.total.value()
 	return hit, miss, hitTotal, missTotal
 }
+
+// Value returns the hits & misses of the window
 func (counter *Counter) Value() (int64, int64) {
 	return counter.total.value()
 }
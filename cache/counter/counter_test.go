@@ -31,7 +31,7 @@ func TestCount(t *testing.T) {
 	}
 
 	time.Sleep(time.Second * 10)
-	hits, misses, hitT, missT := c.snapshot()
+	hits, misses, hitT, missT := c.Snapshot()
 	hitSum, missSum := int64(0), int64(0)
 	for i := 0; i < 10; i++ {
 		hitSum += hits[i]
@@ -39,3 +39,22 @@ func TestCount(t *testing.T) {
 	}
 	t.Log(hitSum, missSum, hitT, missT)
 }
+
+func TestAutoAdvance(t *testing.T) {
+	c := New(2)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	c.Hit()
+	c.Miss()
+	if hit, miss := c.Value(); hit != 1 || miss != 1 {
+		t.Fatalf("value failed, got %d, %d", hit, miss)
+	}
+
+	// the whole window is dropped after advancing twice
+	c.AutoAdvance(100*time.Millisecond, stop)
+	time.Sleep(300 * time.Millisecond)
+	if hit, miss := c.Value(); hit != 0 || miss != 0 {
+		t.Fatalf("value after advance failed, got %d, %d", hit, miss)
+	}
+}
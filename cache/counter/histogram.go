@@ -0,0 +1,241 @@
+package counter
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// every power of two range is split into 2^histPrecision linear buckets,
+	// so the relative error of the percentiles is less than 1/2^histPrecision
+	histPrecision = 4
+	histSubCount  = 1 << histPrecision
+	// the durations longer than 2^histMaxBits ns (about 18 minutes) are
+	// counted in the last bucket
+	histMaxBits    = 40
+	histBucketsNum = (histMaxBits - histPrecision + 1) * histSubCount
+)
+
+// defaults of the histogram, used if the arguments of NewHistogram are not
+// positive
+const (
+	DefaultHistogramWindows    = 6
+	DefaultHistogramWindowSize = 10 * time.Second
+)
+
+// histBucket returns the log-linear bucket index of the value
+func histBucket(v int64) int {
+	if v < histSubCount {
+		return int(max(v, 0))
+	}
+	shift := bits.Len64(uint64(v)) - histPrecision - 1
+	idx := (shift+1)*histSubCount + int(v>>shift) - histSubCount
+	return min(idx, histBucketsNum-1)
+}
+
+// histUpperBound returns the largest value of the bucket
+func histUpperBound(idx int) int64 {
+	if idx < histSubCount {
+		return int64(idx)
+	}
+	shift := idx/histSubCount - 1
+	m := int64(idx%histSubCount + histSubCount)
+	return (m+1)<<shift - 1
+}
+
+type histWindow struct {
+	seq    int64
+	count  int64
+	sum    int64
+	max    int64
+	counts [histBucketsNum]int64
+}
+
+// Histogram is a lock-free rolling histogram of durations, it is made up of
+// windows of the same size, and advances on its own clock like Window.
+// The samples racing with the rotation of their window may be dropped
+type Histogram struct {
+	clock      Clock
+	windowSize time.Duration
+	created    time.Time
+	windows    []atomic.Pointer[histWindow]
+	// count & sum of all the recorded durations
+	count int64
+	sum   int64
+}
+
+// NewHistogram creates a histogram over the last number of windows, the
+// defaults are used if windows or windowSize is not positive
+func NewHistogram(windows int, windowSize time.Duration, opts ...WindowOption) *Histogram {
+	options := windowOptions{clock: SystemClock}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if windows <= 0 {
+		windows = DefaultHistogramWindows
+	}
+	if windowSize <= 0 {
+		windowSize = DefaultHistogramWindowSize
+	}
+	return &Histogram{
+		clock:      options.clock,
+		windowSize: windowSize,
+		created:    options.clock.Now(),
+		windows:    make([]atomic.Pointer[histWindow], windows),
+	}
+}
+
+func (h *Histogram) seq() int64 {
+	return max(int64(h.clock.Now().Sub(h.created)/h.windowSize), 0)
+}
+
+// window returns the window of seq, a new one is swapped in if the window
+// in the slot is older
+func (h *Histogram) window(seq int64) *histWindow {
+	slot := &h.windows[seq%int64(len(h.windows))]
+	for {
+		w := slot.Load()
+		if w != nil && w.seq >= seq {
+			return w
+		}
+		if slot.CompareAndSwap(w, &histWindow{seq: seq}) {
+			return slot.Load()
+		}
+	}
+}
+
+// Record a duration
+func (h *Histogram) Record(d time.Duration) {
+	w := h.window(h.seq())
+	v := int64(d)
+	atomic.AddInt64(&w.counts[histBucket(v)], 1)
+	atomic.AddInt64(&w.count, 1)
+	atomic.AddInt64(&w.sum, v)
+	atomic.AddInt64(&h.count, 1)
+	atomic.AddInt64(&h.sum, v)
+	for {
+		m := atomic.LoadInt64(&w.max)
+		if v <= m || atomic.CompareAndSwapInt64(&w.max, m, v) {
+			break
+		}
+	}
+}
+
+// Since records the duration since the start, it can be deferred:
+//
+//	defer h.Since(time.Now())
+func (h *Histogram) Since(start time.Time) {
+	h.Record(time.Since(start))
+}
+
+// Total returns the count & sum of all the recorded durations since the
+// histogram is created
+func (h *Histogram) Total() (int64, time.Duration) {
+	return atomic.LoadInt64(&h.count), time.Duration(atomic.LoadInt64(&h.sum))
+}
+
+// Snapshot of the windows of the histogram
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	seq := h.seq()
+	var s HistogramSnapshot
+	for idx := range h.windows {
+		w := h.windows[idx].Load()
+		if w == nil || w.seq <= seq-int64(len(h.windows)) || w.seq > seq {
+			continue
+		}
+		if s.counts == nil {
+			s.counts = make([]int64, histBucketsNum)
+		}
+		for i := range w.counts {
+			s.counts[i] += atomic.LoadInt64(&w.counts[i])
+		}
+		s.Count += atomic.LoadInt64(&w.count)
+		s.Sum += time.Duration(atomic.LoadInt64(&w.sum))
+		s.Max = max(s.Max, time.Duration(atomic.LoadInt64(&w.max)))
+	}
+	return s
+}
+
+// HistogramSnapshot is the merged histogram of the windows
+type HistogramSnapshot struct {
+	Count int64
+	Sum   time.Duration
+	Max   time.Duration
+
+	counts []int64
+}
+
+// HistogramBucket is a non-empty bucket of the histogram
+type HistogramBucket struct {
+	// UpperBound is the largest duration of the bucket
+	UpperBound time.Duration
+	Count      int64
+}
+
+// Merge the other snapshot into s, the snapshots of the histograms in
+// different places can be merged into one
+func (s *HistogramSnapshot) Merge(other HistogramSnapshot) {
+	if other.counts == nil {
+		return
+	}
+	if s.counts == nil {
+		s.counts = make([]int64, histBucketsNum)
+	}
+	for i := range other.counts {
+		s.counts[i] += other.counts[i]
+	}
+	s.Count += other.Count
+	s.Sum += other.Sum
+	s.Max = max(s.Max, other.Max)
+}
+
+// Buckets returns the non-empty buckets from the shortest to the longest one
+func (s HistogramSnapshot) Buckets() []HistogramBucket {
+	var buckets []HistogramBucket
+	for idx, n := range s.counts {
+		if n > 0 {
+			buckets = append(buckets, HistogramBucket{time.Duration(histUpperBound(idx)), n})
+		}
+	}
+	return buckets
+}
+
+// Mean of the durations
+func (s HistogramSnapshot) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / time.Duration(s.Count)
+}
+
+// Percentile returns the duration of the percentile q in [0, 1], the upper
+// bound of the bucket is returned, but it never exceeds the Max
+func (s HistogramSnapshot) Percentile(q float64) time.Duration {
+	var total int64
+	for _, n := range s.counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := max(int64(math.Ceil(q*float64(total))), 1)
+	var seen int64
+	for idx, n := range s.counts {
+		seen += n
+		if seen >= rank {
+			return min(time.Duration(histUpperBound(idx)), s.Max)
+		}
+	}
+	return s.Max
+}
+
+// P50 is the median of the durations
+func (s HistogramSnapshot) P50() time.Duration { return s.Percentile(0.5) }
+
+// P90 of the durations
+func (s HistogramSnapshot) P90() time.Duration { return s.Percentile(0.9) }
+
+// P99 of the durations
+func (s HistogramSnapshot) P99() time.Duration { return s.Percentile(0.99) }
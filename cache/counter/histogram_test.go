@@ -0,0 +1,113 @@
+package counter
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	for i := 0; i < 100000; i++ {
+		v := rand.Int63n(1 << uint(rand.Intn(40)+1))
+		idx := histBucket(v)
+		upper := histUpperBound(idx)
+		lower := int64(0)
+		if idx > 0 {
+			lower = histUpperBound(idx-1) + 1
+		}
+		if v < lower || v > upper || float64(upper-lower) > float64(v)/histSubCount {
+			t.Fatalf("bucket of %d failed, got %d [%d, %d]", v, idx, lower, upper)
+		}
+	}
+	if idx := histBucket(1 << 62); idx != histBucketsNum-1 {
+		t.Fatalf("bucket of the large value failed, got %d", idx)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	h := NewHistogram(2, time.Second, WithClock(clock))
+
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	s := h.Snapshot()
+	testCases := []struct {
+		name   string
+		got    time.Duration
+		expect time.Duration
+	}{
+		{"p50", s.P50(), 500 * time.Millisecond},
+		{"p90", s.P90(), 900 * time.Millisecond},
+		{"p99", s.P99(), 990 * time.Millisecond},
+		{"max", s.Max, 1000 * time.Millisecond},
+		{"mean", s.Mean(), 500500 * time.Microsecond},
+	}
+	for _, tc := range testCases {
+		if diff := tc.got - tc.expect; diff < 0 || diff > tc.expect/histSubCount {
+			t.Fatalf("test key %s failed, expect %v, got %v", tc.name, tc.expect, tc.got)
+		}
+	}
+
+	// the first window is still in the histogram
+	clock.Advance(time.Second)
+	h.Record(2 * time.Second)
+	if s := h.Snapshot(); s.Count != 1001 || s.Max != 2*time.Second {
+		t.Fatalf("snapshot of 2 windows failed, got %d, %v", s.Count, s.Max)
+	}
+	// the first window is dropped
+	clock.Advance(time.Second)
+	if s := h.Snapshot(); s.Count != 1 || s.P50() != 2*time.Second {
+		t.Fatalf("snapshot of the last window failed, got %d, %v", s.Count, s.P50())
+	}
+	clock.Advance(time.Second)
+	if s := h.Snapshot(); s.Count != 0 || s.P99() != 0 || len(s.Buckets()) != 0 {
+		t.Fatalf("snapshot of the empty window failed, got %+v", s)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	h1, h2 := NewHistogram(1, time.Minute), NewHistogram(1, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h1.Record(time.Millisecond)
+				h2.Record(time.Duration(i+1) * time.Second)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var s HistogramSnapshot
+	s.Merge(h1.Snapshot())
+	s.Merge(h2.Snapshot())
+	if s.Count != 2000 || s.Max != 10*time.Second || s.P50() < time.Millisecond || s.P50() > time.Millisecond*17/16 {
+		t.Fatalf("merge failed, got %d, %v, %v", s.Count, s.Max, s.P50())
+	}
+	var n int64
+	for _, b := range s.Buckets() {
+		n += b.Count
+	}
+	if n != 2000 {
+		t.Fatalf("buckets failed, expect 2000, got %d", n)
+	}
+}
+
+func TestHistogramDefaults(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	h := NewHistogram(0, 0, WithClock(clock))
+	h.Record(time.Millisecond)
+	clock.Advance((DefaultHistogramWindows - 1) * DefaultHistogramWindowSize)
+	h.Record(time.Millisecond)
+	if s := h.Snapshot(); s.Count != 2 {
+		t.Fatalf("snapshot of the default windows failed, expect 2, got %d", s.Count)
+	}
+	clock.Advance(DefaultHistogramWindowSize)
+	if s := h.Snapshot(); s.Count != 1 {
+		t.Fatalf("snapshot of the last windows failed, expect 1, got %d", s.Count)
+	}
+}
@@ -0,0 +1,197 @@
+package counter
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaults of the window, used if the arguments of NewWindow are not positive
+const (
+	DefaultWindowBuckets    = 10
+	DefaultWindowBucketSize = time.Second
+)
+
+type windowOptions struct {
+	clock Clock
+}
+
+// WindowOption for the rolling window
+type WindowOption func(opts *windowOptions)
+
+// WithClock sets the clock of the window
+func WithClock(clock Clock) WindowOption {
+	return func(opts *windowOptions) {
+		opts.clock = clock
+	}
+}
+
+// Window is a rolling window of named counters, it is made up of buckets
+// of the same size, and advances on its own clock: the buckets which fall
+// out of the window are dropped when the window is accessed
+type Window struct {
+	clock      Clock
+	bucketSize time.Duration
+	created    time.Time
+
+	sync.Mutex
+	names   map[string]int
+	buckets []windowBucket
+	// seq of the current bucket, the bucket of seq is buckets[seq%len(buckets)]
+	seq int64
+}
+
+type windowBucket struct {
+	seq    int64
+	counts []int64
+}
+
+// Bucket is the snapshot of a bucket of the window
+type Bucket struct {
+	Start  time.Time
+	Counts map[string]int64
+}
+
+// WindowSnapshot is the snapshot of the window, the buckets are ordered from
+// the oldest to the current one
+type WindowSnapshot struct {
+	Time       time.Time
+	BucketSize time.Duration
+	Buckets    []Bucket
+	// Span is the time the window covers, it is less than the whole window
+	// if the window is created recently or the current bucket is not full
+	Span time.Duration
+}
+
+// NewWindow creates a rolling window with the number of buckets, the
+// defaults are used if buckets or bucketSize is not positive
+func NewWindow(buckets int, bucketSize time.Duration, opts ...WindowOption) *Window {
+	options := windowOptions{clock: SystemClock}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if buckets <= 0 {
+		buckets = DefaultWindowBuckets
+	}
+	if bucketSize <= 0 {
+		bucketSize = DefaultWindowBucketSize
+	}
+	w := &Window{
+		clock:      options.clock,
+		bucketSize: bucketSize,
+		created:    options.clock.Now(),
+		names:      map[string]int{},
+		buckets:    make([]windowBucket, buckets),
+	}
+	for idx := range w.buckets {
+		w.buckets[idx].seq = -1
+	}
+	return w
+}
+
+// advance to the bucket of now, must be called with the lock held
+func (w *Window) advance(now time.Time) {
+	// the window never goes back even if the clock does
+	if seq := int64(now.Sub(w.created) / w.bucketSize); seq > w.seq {
+		w.seq = seq
+	}
+}
+
+func (w *Window) bucket(seq int64) *windowBucket {
+	b := &w.buckets[seq%int64(len(w.buckets))]
+	if b.seq != seq {
+		b.seq = seq
+		clear(b.counts)
+	}
+	return b
+}
+
+// Add n to the named counter
+func (w *Window) Add(name string, n int64) {
+	w.Lock()
+	defer w.Unlock()
+	w.advance(w.clock.Now())
+
+	idx, ok := w.names[name]
+	if !ok {
+		idx = len(w.names)
+		w.names[name] = idx
+	}
+	b := w.bucket(w.seq)
+	if idx >= len(b.counts) {
+		b.counts = append(b.counts, make([]int64, len(w.names)-len(b.counts))...)
+	}
+	b.counts[idx] += n
+}
+
+// Inc the named counter by one
+func (w *Window) Inc(name string) {
+	w.Add(name, 1)
+}
+
+// Names of the counters which have ever been added
+func (w *Window) Names() []string {
+	w.Lock()
+	defer w.Unlock()
+	names := make([]string, 0, len(w.names))
+	for name := range w.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sum of the named counter over the window
+func (w *Window) Sum(name string) int64 {
+	return w.Snapshot().Sum(name)
+}
+
+// Rate per second of the named counter over the window
+func (w *Window) Rate(name string) float64 {
+	return w.Snapshot().Rate(name)
+}
+
+// Snapshot of the buckets in the window
+func (w *Window) Snapshot() WindowSnapshot {
+	w.Lock()
+	defer w.Unlock()
+	now := w.clock.Now()
+	w.advance(now)
+
+	s := WindowSnapshot{Time: now, BucketSize: w.bucketSize}
+	first := max(w.seq-int64(len(w.buckets))+1, 0)
+	for seq := first; seq <= w.seq; seq++ {
+		b := w.bucket(seq)
+		counts := make(map[string]int64, len(w.names))
+		for name, idx := range w.names {
+			if idx < len(b.counts) {
+				counts[name] = b.counts[idx]
+			} else {
+				counts[name] = 0
+			}
+		}
+		s.Buckets = append(s.Buckets, Bucket{
+			Start:  w.created.Add(time.Duration(seq) * w.bucketSize),
+			Counts: counts,
+		})
+	}
+	s.Span = now.Sub(s.Buckets[0].Start)
+	return s
+}
+
+// Sum of the named counter over the buckets
+func (s WindowSnapshot) Sum(name string) int64 {
+	var sum int64
+	for _, b := range s.Buckets {
+		sum += b.Counts[name]
+	}
+	return sum
+}
+
+// Rate per second of the named counter over the span of the snapshot
+func (s WindowSnapshot) Rate(name string) float64 {
+	if s.Span <= 0 {
+		return 0
+	}
+	return float64(s.Sum(name)) / s.Span.Seconds()
+}
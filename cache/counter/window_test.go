@@ -0,0 +1,82 @@
+package counter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindow(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	w := NewWindow(3, time.Second, WithClock(clock))
+
+	w.Add("requests", 10)
+	w.Inc("errors")
+	if s := w.Snapshot(); len(s.Buckets) != 1 || s.Span != 0 || s.Rate("requests") != 0 {
+		t.Fatalf("snapshot of the new window failed, got %+v", s)
+	}
+
+	testCases := []struct {
+		advance      time.Duration
+		requests     int64
+		expectSum    int64
+		expectRate   float64
+		expectBucket int
+	}{
+		// 10 in the first half second
+		{500 * time.Millisecond, 0, 10, 20, 1},
+		{500 * time.Millisecond, 20, 30, 30, 2},
+		{time.Second, 30, 60, 30, 3},
+		// the first bucket is dropped
+		{time.Second, 0, 50, 25, 3},
+		// the whole window is dropped
+		{5 * time.Second, 6, 6, 6.0 / 2, 3},
+	}
+	for idx, tc := range testCases {
+		clock.Advance(tc.advance)
+		w.Add("requests", tc.requests)
+		s := w.Snapshot()
+		if sum, rate := s.Sum("requests"), s.Rate("requests"); sum != tc.expectSum || rate != tc.expectRate || len(s.Buckets) != tc.expectBucket {
+			t.Fatalf("test case %d failed, expect %d, %v, %d, got %d, %v, %d", idx, tc.expectSum, tc.expectRate, tc.expectBucket, sum, rate, len(s.Buckets))
+		}
+	}
+
+	s := w.Snapshot()
+	if s.Buckets[0].Start != time.Unix(1006, 0) || s.Buckets[2].Counts["requests"] != 6 || s.Buckets[2].Counts["errors"] != 0 {
+		t.Fatalf("buckets failed, got %+v", s.Buckets)
+	}
+	if names := w.Names(); len(names) != 2 || names[0] != "errors" {
+		t.Fatalf("names failed, got %v", names)
+	}
+
+	// the window does not go back with the clock
+	clock.Advance(-10 * time.Second)
+	w.Inc("requests")
+	if sum := w.Sum("requests"); sum != 7 {
+		t.Fatalf("sum failed, expect 7, got %d", sum)
+	}
+}
+
+func TestWindowDefaults(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	testCases := []struct {
+		buckets    int
+		bucketSize time.Duration
+	}{
+		{0, 0},
+		{-1, -time.Second},
+	}
+	for idx, tc := range testCases {
+		w := NewWindow(tc.buckets, tc.bucketSize, WithClock(clock))
+		w.Inc("requests")
+		clock.Advance(DefaultWindowBucketSize)
+		w.Inc("requests")
+		s := w.Snapshot()
+		if s.BucketSize != DefaultWindowBucketSize || len(s.Buckets) != 2 || s.Sum("requests") != 2 {
+			t.Fatalf("test case %d failed, got %+v", idx, s)
+		}
+		clock.Advance(DefaultWindowBuckets * DefaultWindowBucketSize)
+		if sum := w.Sum("requests"); sum != 0 {
+			t.Fatalf("test case %d failed, expect 0, got %d", idx, sum)
+		}
+	}
+}
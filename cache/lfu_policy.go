@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// lfuPolicy keeps the entries in a min heap ordered by the access frequency,
+// and then the last access tick
+type lfuPolicy struct {
+	heap lfuHeap
+	tick uint64
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{}
+}
+
+func (p *lfuPolicy) add(entry *listEntry) {
+	p.tick++
+	entry.freq = 1
+	entry.tick = p.tick
+	heap.Push(&p.heap, entry)
+}
+
+func (p *lfuPolicy) access(entry *listEntry) {
+	p.tick++
+	entry.freq++
+	entry.tick = p.tick
+	heap.Fix(&p.heap, entry.index)
+}
+
+func (p *lfuPolicy) remove(entry *listEntry) {
+	heap.Remove(&p.heap, entry.index)
+}
+
+func (p *lfuPolicy) victim(added *listEntry) *listEntry {
+	if len(p.heap) == 0 {
+		return nil
+	}
+	if p.heap[0] != added {
+		return p.heap[0]
+	}
+	// the added one is the least frequent, the next is one of its children
+	var victim *listEntry
+	for _, idx := range []int{1, 2} {
+		if idx < len(p.heap) && (victim == nil || p.heap.Less(idx, victim.index)) {
+			victim = p.heap[idx]
+		}
+	}
+	return victim
+}
+
+func (p *lfuPolicy) entries() []*listEntry {
+	entries := append([]*listEntry(nil), p.heap...)
+	sort.Slice(entries, func(i, j int) bool {
+		return lfuHeap(entries).Less(i, j)
+	})
+	return entries
+}
+
+type lfuHeap []*listEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	entry := x.(*listEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*h = old[:n-1]
+	return entry
+}
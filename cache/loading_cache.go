@@ -0,0 +1,356 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/leopoldxx/go-utils/concurrency"
+	"github.com/leopoldxx/go-utils/errors"
+	"github.com/leopoldxx/go-utils/trace"
+)
+
+// Loader loads the value of the key when it is missed in the cache
+type Loader func(ctx context.Context, key Key) (Value, error)
+
+var errNoLoader = errors.New("no loader is registered")
+
+// LoadingOption func for the loading cache
+type LoadingOption func(opts *loadingOptions)
+
+type loadingOptions struct {
+	ttl          time.Duration
+	errorTTL     time.Duration
+	refreshAhead float64
+	staleIfError time.Duration
+	negativeTTL  time.Duration
+	loader       Loader
+}
+
+// LoadTTL will set the cache time of the loaded values, Config.CacheTime is
+// used by default
+func LoadTTL(ttl time.Duration) LoadingOption {
+	return func(opts *loadingOptions) {
+		opts.ttl = ttl
+	}
+}
+
+// CacheErrors will cache the errors returned by the loader for ttl, errors
+// are not cached by default
+func CacheErrors(ttl time.Duration) LoadingOption {
+	return func(opts *loadingOptions) {
+		opts.errorTTL = ttl
+	}
+}
+
+// RefreshAhead will refresh the value in the background once it has passed
+// the fraction of its ttl, the current value is returned meanwhile.
+// The fraction should be in (0, 1)
+func RefreshAhead(fraction float64) LoadingOption {
+	return func(opts *loadingOptions) {
+		opts.refreshAhead = fraction
+	}
+}
+
+// StaleIfError will serve the expired value for at most d if the reload of
+// it fails
+func StaleIfError(d time.Duration) LoadingOption {
+	return func(opts *loadingOptions) {
+		opts.staleIfError = d
+	}
+}
+
+// NegativeTTL will cache the not found errors returned by the loader for ttl,
+// see errors.IsNotFoundError. It takes precedence over CacheErrors, and
+// the negative entries are counted separately in Stats
+func NegativeTTL(ttl time.Duration) LoadingOption {
+	return func(opts *loadingOptions) {
+		opts.negativeTTL = ttl
+	}
+}
+
+// WithLoader will register the default loader used by Get and the refreshes
+func WithLoader(loader Loader) LoadingOption {
+	return func(opts *loadingOptions) {
+		opts.loader = loader
+	}
+}
+
+// loadedEntry is the value stored in the underlying cache
+type loadedEntry struct {
+	value     Value
+	err       error
+	negative  bool
+	refreshAt time.Time
+	expireAt  time.Time
+	// 1 if a background refresh is running
+	refreshing int32
+}
+
+func (le *loadedEntry) fresh(now time.Time) bool {
+	return le.err != nil || now.Before(le.refreshAt)
+}
+
+// LoadingCache is a read-through cache, concurrent misses of the same key
+// will only run the loader once. The panic of the loader is returned as a
+// concurrency.PanicError
+type LoadingCache struct {
+	cache Cache
+	opts  loadingOptions
+	calls loadGroup
+
+	negativeHits int64
+	mu           sync.Mutex
+	negatives    map[Key]struct{}
+}
+
+// NewLoadingCache will create a loading cache with the configs, the callbacks
+// of the config are only called for the loaded values
+func NewLoadingCache(config Config, opts ...LoadingOption) *LoadingCache {
+	lc := &LoadingCache{negatives: map[Key]struct{}{}}
+	for idx := range opts {
+		opts[idx](&lc.opts)
+	}
+	if lc.opts.ttl <= 0 {
+		lc.opts.ttl = config.CacheTime
+		if lc.opts.ttl < time.Millisecond {
+			lc.opts.ttl = DefaultCacheTime
+		}
+	}
+	if cb := config.Callback; cb != nil {
+		config.Callback = func(key Key, value Value) {
+			if le := value.(*loadedEntry); le.err == nil {
+				cb(key, le.value)
+			}
+		}
+	}
+	cb := config.ReasonCallback
+	config.ReasonCallback = func(key Key, value Value, reason EvictReason) {
+		le := value.(*loadedEntry)
+		if le.negative {
+			lc.mu.Lock()
+			delete(lc.negatives, key)
+			lc.mu.Unlock()
+		}
+		if cb != nil && le.err == nil {
+			cb(key, le.value, reason)
+		}
+	}
+	lc.cache = NewCacheWithConfig(config)
+	return lc
+}
+
+// Get returns the cached value of the key, or loads it by the registered loader
+func (lc *LoadingCache) Get(ctx context.Context, key Key) (Value, error) {
+	if lc.opts.loader == nil {
+		return nil, errNoLoader
+	}
+	return lc.GetOrLoad(ctx, key, lc.opts.loader)
+}
+
+// GetOrLoad returns the cached value of the key, or loads it by the loader if
+// it is missed. The loader receives a context which carries the trace of ctx
+func (lc *LoadingCache) GetOrLoad(ctx context.Context, key Key, loader Loader) (Value, error) {
+	le, ok := lc.get(key)
+	if !ok {
+		return lc.load(ctx, key, loader, nil)
+	}
+
+	now := time.Now()
+	switch {
+	case le.fresh(now):
+		if le.negative {
+			atomic.AddInt64(&lc.negativeHits, 1)
+		}
+		return le.value, le.err
+	case now.Before(le.expireAt):
+		// refresh ahead, only one refresh is running for the entry
+		if atomic.CompareAndSwapInt32(&le.refreshing, 0, 1) {
+			go lc.refresh(ctx, key, loader, le)
+		}
+		return le.value, nil
+	}
+
+	if !now.Before(le.expireAt.Add(lc.opts.staleIfError)) {
+		return lc.load(ctx, key, loader, nil)
+	}
+	// expired, but it is still in the stale window
+	value, err := lc.load(ctx, key, loader, le)
+	if err != nil && !lc.isNegative(err) {
+		trace.GetTraceFromContext(ctx).Warnf("event=[cache-serve-stale] key=[%v] err=[%v]", key, err)
+		return le.value, nil
+	}
+	// the key may be deleted at the source, the not found error is returned
+	return value, err
+}
+
+// refresh the entry in the background, it is not canceled by the caller
+func (lc *LoadingCache) refresh(ctx context.Context, key Key, loader Loader, stale *loadedEntry) {
+	ctx = trace.WithTraceForContext2(context.Background(), trace.GetTraceFromContext(ctx))
+	defer atomic.StoreInt32(&stale.refreshing, 0)
+	defer trace.HandleCrash(func(r interface{}) {
+		trace.LogCrashStack(ctx, r)
+	})
+	if _, err := lc.load(ctx, key, loader, stale); err != nil {
+		trace.GetTraceFromContext(ctx).Warnf("event=[cache-refresh-failed] key=[%v] err=[%v]", key, err)
+	}
+}
+
+// load the value of the key, the stale entry is kept if the load fails.
+// The caller stops waiting if ctx is done, but the load goes on for the others
+func (lc *LoadingCache) load(ctx context.Context, key Key, loader Loader, stale *loadedEntry) (Value, error) {
+	return lc.calls.doContext(ctx, key, func(ctx context.Context) (Value, error) {
+		// the value may have been loaded by the former call just now, peek
+		// it so the miss is not counted twice
+		if le, ok := lc.peek(key); ok && le.fresh(time.Now()) {
+			return le.value, le.err
+		}
+		ctx = trace.WithTraceForContext2(ctx, trace.GetTraceFromContext(ctx))
+		value, err := loader(ctx, key)
+		// the stale entry is replaced if it is not found any more
+		if err == nil || stale == nil || lc.isNegative(err) {
+			lc.store(key, &loadedEntry{value: value, err: err, negative: lc.isNegative(err)})
+		}
+		return value, err
+	})
+}
+
+type loadCall struct {
+	done  chan struct{}
+	value Value
+	err   error
+}
+
+// loadGroup collapses the concurrent loads of the same key into one, it is
+// keyed by the Key itself, so the keys are compared as the cache does
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[Key]*loadCall
+}
+
+// doContext calls fn once for the concurrent calls of the key, the caller
+// stops waiting if ctx is done, but the call goes on for the others. fn gets
+// a context which carries the values and the deadline of the first caller
+func (g *loadGroup) doContext(ctx context.Context, key Key, fn func(ctx context.Context) (Value, error)) (Value, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[Key]*loadCall{}
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &loadCall{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.call(ctx, c, key, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *loadGroup) call(ctx context.Context, c *loadCall, key Key, fn func(ctx context.Context) (Value, error)) {
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	defer trace.HandleCrash(func(r interface{}) {
+		c.err = &concurrency.PanicError{Value: r, Stack: trace.Stacks(false)}
+	})
+	// detached from the cancellation of the caller, but not its deadline
+	callCtx := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithDeadline(callCtx, deadline)
+		defer cancel()
+	}
+	c.value, c.err = fn(callCtx)
+}
+
+func (lc *LoadingCache) get(key Key) (*loadedEntry, bool) {
+	if v, ok := lc.cache.Get(key); ok {
+		return v.(*loadedEntry), true
+	}
+	return nil, false
+}
+
+func (lc *LoadingCache) peek(key Key) (*loadedEntry, bool) {
+	if v, ok := lc.cache.Peek(key); ok {
+		return v.(*loadedEntry), true
+	}
+	return nil, false
+}
+
+func (lc *LoadingCache) isNegative(err error) bool {
+	return lc.opts.negativeTTL > 0 && errors.IsNotFoundError(err)
+}
+
+func (lc *LoadingCache) store(key Key, le *loadedEntry) {
+	// the set is updated before the put, the entry may be evicted at once
+	lc.mu.Lock()
+	if le.negative {
+		lc.negatives[key] = struct{}{}
+	} else {
+		delete(lc.negatives, key)
+	}
+	lc.mu.Unlock()
+
+	if le.negative {
+		lc.cache.PutWithTimeout(key, le, lc.opts.negativeTTL)
+		return
+	}
+	if le.err != nil {
+		if lc.opts.errorTTL > 0 {
+			lc.cache.PutWithTimeout(key, le, lc.opts.errorTTL)
+		}
+		return
+	}
+
+	now := time.Now()
+	le.expireAt = now.Add(lc.opts.ttl)
+	le.refreshAt = le.expireAt
+	if lc.opts.refreshAhead > 0 && lc.opts.refreshAhead < 1 {
+		le.refreshAt = now.Add(time.Duration(float64(lc.opts.ttl) * lc.opts.refreshAhead))
+	}
+	// the value is kept for the stale window after it is expired
+	lc.cache.PutWithTimeout(key, le, lc.opts.ttl+lc.opts.staleIfError)
+}
+
+// Put a value with the load ttl
+func (lc *LoadingCache) Put(key Key, value Value) {
+	lc.store(key, &loadedEntry{value: value})
+}
+
+// Del the key and return the deleted value
+func (lc *LoadingCache) Del(key Key) Value {
+	if le, ok := lc.cache.Del(key).(*loadedEntry); ok {
+		return le.value
+	}
+	return nil
+}
+
+// Len of the cached keys
+func (lc *LoadingCache) Len() int {
+	return lc.cache.Len()
+}
+
+// Stats of the cache
+func (lc *LoadingCache) Stats() Stats {
+	s := lc.cache.Stats()
+	s.NegativeHits = atomic.LoadInt64(&lc.negativeHits)
+	lc.mu.Lock()
+	s.NegativeEntries = len(lc.negatives)
+	lc.mu.Unlock()
+	return s
+}
+
+// Close the cache
+func (lc *LoadingCache) Close() {
+	lc.cache.Close()
+}
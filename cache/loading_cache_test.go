@@ -0,0 +1,285 @@
+package cache_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/leopoldxx/go-utils/cache"
+	"github.com/leopoldxx/go-utils/concurrency"
+	"github.com/leopoldxx/go-utils/errors"
+	"github.com/leopoldxx/go-utils/trace"
+)
+
+func TestLoadingCacheDedup(t *testing.T) {
+	cache := NewLoadingCache(Config{MaxLen: 10})
+	defer cache.Close()
+
+	var loads int32
+	loader := func(ctx context.Context, key Key) (Value, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(100 * time.Millisecond)
+		return key.(string) + "-value", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cache.GetOrLoad(context.Background(), "testkey", loader)
+			if err != nil || v != "testkey-value" {
+				t.Errorf("load testkey failed, got %v, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if loads != 1 {
+		t.Fatalf("loader should be called once, got %d", loads)
+	}
+	if v, err := cache.GetOrLoad(context.Background(), "testkey", loader); err != nil || v != "testkey-value" || loads != 1 {
+		t.Fatalf("get cached testkey failed, got %v, %v, loads %d", v, err, loads)
+	}
+
+	// a load is counted as one miss
+	misses := cache.Stats().Misses
+	cache.GetOrLoad(context.Background(), "otherkey", loader)
+	if s := cache.Stats(); s.Misses != misses+1 {
+		t.Fatalf("misses failed, expect %d, got %d", misses+1, s.Misses)
+	}
+}
+
+func TestLoadingCacheDistinctKeys(t *testing.T) {
+	cache := NewLoadingCache(Config{MaxLen: 10})
+	defer cache.Close()
+
+	var loads int32
+	loader := func(ctx context.Context, key Key) (Value, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(100 * time.Millisecond)
+		return key, nil
+	}
+
+	// the pointers to equal values are different keys of the cache, and
+	// so are 1 and "1"
+	v1, v2 := "testkey", "testkey"
+	keys := []Key{&v1, &v2, 1, "1"}
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key Key) {
+			defer wg.Done()
+			if v, err := cache.GetOrLoad(context.Background(), key, loader); err != nil || v != key {
+				t.Errorf("load key %v failed, got %v, %v", key, v, err)
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	if loads != int32(len(keys)) {
+		t.Fatalf("loader should be called %d times, got %d", len(keys), loads)
+	}
+}
+
+func TestLoadingCachePanic(t *testing.T) {
+	cache := NewLoadingCache(Config{MaxLen: 10})
+	defer cache.Close()
+
+	loader := func(ctx context.Context, key Key) (Value, error) {
+		panic("load panic")
+	}
+	_, err := cache.GetOrLoad(context.Background(), "testkey", loader)
+	if pe, ok := err.(*concurrency.PanicError); !ok || pe.Value != "load panic" {
+		t.Fatalf("panic of the loader should be returned, got %v", err)
+	}
+}
+
+func TestLoadingCacheErrors(t *testing.T) {
+	testCases := []struct {
+		opts        []LoadingOption
+		expectLoads int
+	}{
+		{nil, 2},
+		{[]LoadingOption{CacheErrors(time.Minute)}, 1},
+	}
+	for _, tc := range testCases {
+		cache := NewLoadingCache(Config{MaxLen: 10}, tc.opts...)
+		loads := 0
+		loader := func(ctx context.Context, key Key) (Value, error) {
+			loads++
+			return nil, errors.New("load failed")
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := cache.GetOrLoad(context.Background(), "testkey", loader); err == nil {
+				t.Fatalf("load testkey should be failed")
+			}
+		}
+		if loads != tc.expectLoads {
+			t.Fatalf("loads failed, expect %d, got %d", tc.expectLoads, loads)
+		}
+		cache.Close()
+	}
+}
+
+func TestLoadingCacheTrace(t *testing.T) {
+	cache := NewLoadingCache(Config{MaxLen: 10})
+	defer cache.Close()
+
+	ctx := trace.WithTraceForContext(context.Background(), "test", "test-trace-id")
+	loader := func(ctx context.Context, key Key) (Value, error) {
+		return trace.GetTraceFromContext(ctx).ID(), nil
+	}
+	if v, err := cache.GetOrLoad(ctx, "testkey", loader); err != nil || v != "test-trace-id" {
+		t.Fatalf("trace of the loader failed, got %v, %v", v, err)
+	}
+}
+
+func TestLoadingCacheCallback(t *testing.T) {
+	evicted := map[Key]Value{}
+	cb := func(key Key, value Value) {
+		evicted[key] = value
+	}
+	cache := NewLoadingCache(Config{MaxLen: 10, Callback: cb})
+	cache.Put("testkey", "testvalue")
+	if v := cache.Del("testkey"); v != "testvalue" {
+		t.Fatalf("del testkey failed, got %v", v)
+	}
+	if evicted["testkey"] != "testvalue" {
+		t.Fatalf("callback of testkey failed, got %v", evicted)
+	}
+	cache.Close()
+}
+
+func TestLoadingCacheRefreshAhead(t *testing.T) {
+	var loads int32
+	loader := func(ctx context.Context, key Key) (Value, error) {
+		return atomic.AddInt32(&loads, 1), nil
+	}
+	cache := NewLoadingCache(Config{MaxLen: 10}, LoadTTL(2*time.Second), RefreshAhead(0.5), WithLoader(loader))
+	defer cache.Close()
+
+	ctx := context.Background()
+	if v, err := cache.Get(ctx, "testkey"); err != nil || v != int32(1) {
+		t.Fatalf("get testkey failed, got %v, %v", v, err)
+	}
+
+	// the current value is returned, and only one refresh is triggered
+	time.Sleep(time.Second + 100*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		if v, err := cache.Get(ctx, "testkey"); err != nil || v != int32(1) {
+			t.Fatalf("get testkey in refresh window failed, got %v, %v", v, err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if v, err := cache.Get(ctx, "testkey"); err != nil || v != int32(2) {
+		t.Fatalf("get refreshed testkey failed, got %v, %v", v, err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("loads failed, expect 2, got %d", n)
+	}
+}
+
+func TestLoadingCacheStaleIfError(t *testing.T) {
+	var failed int32
+	loader := func(ctx context.Context, key Key) (Value, error) {
+		if atomic.LoadInt32(&failed) == 1 {
+			return nil, errors.New("load failed")
+		}
+		return "testvalue", nil
+	}
+	cache := NewLoadingCache(Config{MaxLen: 10}, LoadTTL(time.Second), StaleIfError(time.Second), WithLoader(loader))
+	defer cache.Close()
+
+	ctx := context.Background()
+	if v, err := cache.Get(ctx, "testkey"); err != nil || v != "testvalue" {
+		t.Fatalf("get testkey failed, got %v, %v", v, err)
+	}
+
+	// the stale value is served if the reload fails
+	atomic.StoreInt32(&failed, 1)
+	time.Sleep(time.Second + 100*time.Millisecond)
+	if v, err := cache.Get(ctx, "testkey"); err != nil || v != "testvalue" {
+		t.Fatalf("get stale testkey failed, got %v, %v", v, err)
+	}
+
+	// the stale window is passed
+	time.Sleep(time.Second)
+	if _, err := cache.Get(ctx, "testkey"); err == nil {
+		t.Fatalf("get testkey should be failed after the stale window")
+	}
+}
+
+func TestLoadingCacheStaleNotFound(t *testing.T) {
+	var deleted int32
+	loader := func(ctx context.Context, key Key) (Value, error) {
+		if atomic.LoadInt32(&deleted) == 1 {
+			return nil, errors.NewNotFoundError(key.(string))
+		}
+		return "testvalue", nil
+	}
+	cache := NewLoadingCache(Config{MaxLen: 10}, LoadTTL(time.Second), StaleIfError(time.Second),
+		NegativeTTL(time.Second), WithLoader(loader))
+	defer cache.Close()
+
+	ctx := context.Background()
+	if v, err := cache.Get(ctx, "testkey"); err != nil || v != "testvalue" {
+		t.Fatalf("get testkey failed, got %v, %v", v, err)
+	}
+
+	// the stale value is not served if the key is not found any more
+	atomic.StoreInt32(&deleted, 1)
+	time.Sleep(time.Second + 100*time.Millisecond)
+	if v, err := cache.Get(ctx, "testkey"); !errors.IsNotFoundError(err) || v != nil {
+		t.Fatalf("get deleted testkey should be not found, got %v, %v", v, err)
+	}
+	if _, err := cache.Get(ctx, "testkey"); !errors.IsNotFoundError(err) {
+		t.Fatalf("get negative testkey should be not found, got %v", err)
+	}
+}
+
+func TestLoadingCacheNegative(t *testing.T) {
+	loads := 0
+	loader := func(ctx context.Context, key Key) (Value, error) {
+		loads++
+		if key == "missing" {
+			return nil, errors.NewNotFoundError(key.(string))
+		}
+		return nil, errors.New("load failed")
+	}
+	cache := NewLoadingCache(Config{MaxLen: 10}, NegativeTTL(time.Second), WithLoader(loader))
+	defer cache.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get(ctx, "missing"); !errors.IsNotFoundError(err) {
+			t.Fatalf("get missing should be not found, got %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("loads failed, expect 1, got %d", loads)
+	}
+
+	// other errors are not cached
+	cache.Get(ctx, "failed")
+	cache.Get(ctx, "failed")
+	if loads != 3 {
+		t.Fatalf("loads failed, expect 3, got %d", loads)
+	}
+
+	s := cache.Stats()
+	if s.NegativeHits != 2 || s.NegativeEntries != 1 || s.Len != 1 {
+		t.Fatalf("negative stats failed, got %+v", s)
+	}
+
+	time.Sleep(time.Second + 100*time.Millisecond)
+	if _, err := cache.Get(ctx, "missing"); !errors.IsNotFoundError(err) || loads != 4 {
+		t.Fatalf("get expired missing failed, got %v, loads %d", err, loads)
+	}
+	cache.Del("missing")
+	if s := cache.Stats(); s.NegativeEntries != 0 {
+		t.Fatalf("negative entries failed, got %+v", s)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"container/list"
 	"sync"
 	"time"
+
+	"github.com/leopoldxx/go-utils/cache/counter"
 )
 
 // consts
@@ -14,12 +16,67 @@ const (
 // OnEvicted callback func will be called when the cached key expired
 type OnEvicted func(key Key, value Value)
 
+// EvictReason tells why a cached key is removed from the cache
+type EvictReason int
+
+// eviction reasons
+const (
+	// EvictCapacity means the key is the oldest one when the cache is full
+	EvictCapacity EvictReason = iota
+	// EvictExpired means the key is expired
+	EvictExpired
+	// EvictDeleted means the key is deleted by Del
+	EvictDeleted
+	// EvictClosed means the key is removed by Close
+	EvictClosed
+	// EvictInvalidated means the key is removed by InvalidateTag
+	EvictInvalidated
+
+	numEvictReasons = iota
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictDeleted:
+		return "deleted"
+	case EvictClosed:
+		return "closed"
+	case EvictInvalidated:
+		return "invalidated"
+	}
+	return "unknown"
+}
+
+// CostFunc returns the cost of a cached value, such as the size in bytes
+type CostFunc func(key Key, value Value) int64
+
+// OnEvictedWithReason callback func will be called with the reason when the
+// cached key is removed
+type OnEvictedWithReason func(key Key, value Value, reason EvictReason)
+
 type lruCache struct {
 	maxLen    int
+	maxCost   int64
+	costFunc  CostFunc
+	cost      int64
 	onEvicted OnEvicted
-	lst       *list.List
-	hash      map[Key]*list.Element
+	onRemoved OnEvictedWithReason
+	policy    policy
+	hash      map[Key]*listEntry
+	tags      map[string]map[Key]*listEntry
 	cacheTime time.Duration
+	stop      chan struct{}
+	closeOnce sync.Once
+
+	// statistics
+	hits      int64
+	misses    int64
+	evictions [numEvictReasons]int64
+	window    *counter.Counter
 	sync.Mutex
 }
 
@@ -27,13 +84,45 @@ type listEntry struct {
 	key      Key
 	value    Value
 	deadTime time.Time
+	cost     int64
+	tags     []string
+
+	// bookkeeping fields of the eviction policy
+	elem  *list.Element
+	seg   segment
+	freq  int
+	tick  uint64
+	index int
 }
 
 // Config of the cache
 type Config struct {
-	MaxLen    int
-	Callback  OnEvicted
-	CacheTime time.Duration
+	MaxLen   int
+	Callback OnEvicted
+	// ReasonCallback will be called with the reason when a key is removed,
+	// it can be used together with Callback
+	ReasonCallback OnEvictedWithReason
+	CacheTime      time.Duration
+	// MaxCost limits the total cost of the cached values together with MaxLen,
+	// the number of keys is unlimited if MaxCost is set and MaxLen is 0
+	MaxCost int64
+	// Cost returns the cost of each value, every value costs 1 if it is not set
+	Cost CostFunc
+	// CleanupInterval enables a background sweeper which removes the expired
+	// keys periodically, Close must be called to stop it. Expired keys are only
+	// removed lazily by Get if it is 0
+	CleanupInterval time.Duration
+	// Policy of the eviction when the cache is full, PolicyLRU by default
+	Policy Policy
+	// StatsInterval enables the windowed hit ratio of Stats, the window moves
+	// forward every interval, Close must be called to stop it
+	StatsInterval time.Duration
+	// StatsWindow is the number of intervals of the window, DefaultStatsWindow
+	// is used if it is 0
+	StatsWindow uint16
+	// Shards splits the cache into n independent lru shards to reduce the lock
+	// contention, MaxLen is split across them. A single lru is used if n <= 1
+	Shards int
 }
 
 // NewCache will create a default configured cache
@@ -46,32 +135,101 @@ func NewCacheWithConfig(config Config) Cache {
 	if config.CacheTime < time.Millisecond {
 		config.CacheTime = DefaultCacheTime
 	}
+	if config.Shards > 1 {
+		return newShardedCache(config)
+	}
+	lru := newLRUCache(config)
+	if config.CleanupInterval > 0 {
+		go janitor(config.CleanupInterval, lru.stop, lru.sweep)
+	}
+	lru.window = newStatsWindow(config, lru.stop)
+	return lru
+}
+
+func newLRUCache(config Config) *lruCache {
 	return &lruCache{
 		maxLen:    config.MaxLen,
+		maxCost:   config.MaxCost,
+		costFunc:  config.Cost,
 		onEvicted: config.Callback,
-		lst:       &list.List{},
-		hash:      map[Key]*list.Element{},
+		onRemoved: config.ReasonCallback,
+		policy:    newPolicy(config.Policy, config.MaxLen),
+		hash:      map[Key]*listEntry{},
+		tags:      map[string]map[Key]*listEntry{},
 		cacheTime: config.CacheTime,
+		stop:      make(chan struct{}),
 	}
 }
 
-func (lru *lruCache) removeElem(elem *list.Element) {
-	if elem == nil {
-		return
+// janitor calls sweep every interval until the stop chan is closed
+func janitor(interval time.Duration, stop <-chan struct{}, sweep func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sweep()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (lru *lruCache) sweep() {
+	lru.Lock()
+	defer lru.Unlock()
+	now := time.Now()
+	for _, entry := range lru.hash {
+		if entry.deadTime.Before(now) {
+			lru.removeEntry(entry, EvictExpired)
+		}
 	}
-	lru.lst.Remove(elem)
+}
 
-	entry := elem.Value.(*listEntry)
+func (lru *lruCache) removeEntry(entry *listEntry, reason EvictReason) {
+	if entry == nil {
+		return
+	}
+	lru.policy.remove(entry)
+	lru.untag(entry)
 	delete(lru.hash, entry.key)
+	lru.cost -= entry.cost
+	lru.evictions[reason]++
 	if lru.onEvicted != nil {
 		lru.onEvicted(entry.key, entry.value)
 	}
+	if lru.onRemoved != nil {
+		lru.onRemoved(entry.key, entry.value, reason)
+	}
+}
+
+func (lru *lruCache) full() bool {
+	if lru.maxCost > 0 {
+		return lru.cost > lru.maxCost || (lru.maxLen > 0 && len(lru.hash) > lru.maxLen)
+	}
+	return len(lru.hash) > lru.maxLen
+}
+
+func (lru *lruCache) lazyEvict(added *listEntry) {
+	// the value will never fit in the cache
+	if lru.maxCost > 0 && added.cost > lru.maxCost {
+		lru.removeEntry(added, EvictCapacity)
+		return
+	}
+	for lru.full() {
+		entry := lru.policy.victim(added)
+		if entry == nil {
+			return
+		}
+		lru.removeEntry(entry, EvictCapacity)
+	}
 }
 
-func (lru *lruCache) lazyRemoveOldest() {
-	if len(lru.hash) > lru.maxLen {
-		lru.removeElem(lru.lst.Back())
+func (lru *lruCache) costOf(key Key, value Value) int64 {
+	if lru.costFunc == nil {
+		return 1
 	}
+	return lru.costFunc(key, value)
 }
 
 func (lru *lruCache) Put(key Key, value Value) {
@@ -79,47 +237,163 @@ func (lru *lruCache) Put(key Key, value Value) {
 }
 
 func (lru *lruCache) PutWithTimeout(key Key, value Value, t time.Duration) {
+	lru.Lock()
+	defer lru.Unlock()
+	lru.put(key, value, t)
+}
+
+func (lru *lruCache) PutWithTags(key Key, value Value, t time.Duration, tags ...string) {
+	lru.Lock()
+	defer lru.Unlock()
+	lru.put(key, value, t, tags...)
+}
+
+// put the value, the tags of the existing key are replaced
+func (lru *lruCache) put(key Key, value Value, t time.Duration, tags ...string) {
 	if t < time.Second {
 		t = time.Second
 	}
+	cost := lru.costOf(key, value)
+	entry, exists := lru.hash[key]
+	if exists {
+		lru.policy.access(entry)
+		entry.value = value
+		entry.deadTime = time.Now().Add(t)
+		lru.cost += cost - entry.cost
+		entry.cost = cost
+	} else {
+		entry = &listEntry{key: key, value: value, deadTime: time.Now().Add(t), cost: cost}
+		lru.hash[key] = entry
+		lru.cost += cost
+		lru.policy.add(entry)
+	}
+	lru.tag(entry, tags)
+	lru.lazyEvict(entry)
+}
+
+func (lru *lruCache) tag(entry *listEntry, tags []string) {
+	lru.untag(entry)
+	for _, tag := range tags {
+		if lru.tags[tag] == nil {
+			lru.tags[tag] = map[Key]*listEntry{}
+		}
+		lru.tags[tag][entry.key] = entry
+	}
+	entry.tags = tags
+}
+
+func (lru *lruCache) untag(entry *listEntry) {
+	for _, tag := range entry.tags {
+		delete(lru.tags[tag], entry.key)
+		if len(lru.tags[tag]) == 0 {
+			delete(lru.tags, tag)
+		}
+	}
+	entry.tags = nil
+}
+
+// InvalidateTag removes all the keys with the tag, and returns the number of
+// the removed keys
+func (lru *lruCache) InvalidateTag(tag string) int {
 	lru.Lock()
 	defer lru.Unlock()
-	if elem, exists := lru.hash[key]; exists {
-		lru.lst.MoveToFront(elem)
-		elem.Value.(*listEntry).value = value
-		elem.Value.(*listEntry).deadTime = time.Now().Add(t)
-	} else {
-		lru.hash[key] = lru.lst.PushFront(&listEntry{key: key, value: value, deadTime: time.Now().Add(t)})
-		lru.lazyRemoveOldest()
+	entries := lru.tags[tag]
+	n := len(entries)
+	for _, entry := range entries {
+		lru.removeEntry(entry, EvictInvalidated)
 	}
+	return n
 }
 
 func (lru *lruCache) Get(key Key) (Value, bool) {
 	lru.Lock()
 	defer lru.Unlock()
-	if elem, exists := lru.hash[key]; exists {
-		entry := elem.Value.(*listEntry)
+	return lru.get(key)
+}
+
+func (lru *lruCache) get(key Key) (Value, bool) {
+	if entry, exists := lru.hash[key]; exists {
 		// delete the cached value if it has already timeouted
 		if entry.deadTime.Before(time.Now()) {
-			lru.removeElem(elem)
+			lru.removeEntry(entry, EvictExpired)
+			lru.miss()
 			return nil, false
 		}
-		lru.lst.MoveToFront(elem)
-		return elem.Value.(*listEntry).value, true
+		lru.policy.access(entry)
+		lru.hit()
+		return entry.value, true
 	}
+	lru.miss()
 	return nil, false
-
 }
+
 func (lru *lruCache) Del(key Key) Value {
 	lru.Lock()
 	defer lru.Unlock()
-	if elem, exists := lru.hash[key]; exists {
-		value := elem.Value.(*listEntry).value
-		lru.removeElem(elem)
-		return value
+	return lru.del(key)
+}
+
+func (lru *lruCache) del(key Key) Value {
+	if entry, exists := lru.hash[key]; exists {
+		lru.removeEntry(entry, EvictDeleted)
+		return entry.value
 	}
 	return nil
 }
+
+func (lru *lruCache) GetMulti(keys []Key) map[Key]Value {
+	lru.Lock()
+	defer lru.Unlock()
+	values := make(map[Key]Value, len(keys))
+	for _, key := range keys {
+		if value, ok := lru.get(key); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+func (lru *lruCache) PutMulti(values map[Key]Value) {
+	lru.Lock()
+	defer lru.Unlock()
+	for key, value := range values {
+		lru.put(key, value, lru.cacheTime)
+	}
+}
+
+func (lru *lruCache) DelMulti(keys []Key) map[Key]Value {
+	lru.Lock()
+	defer lru.Unlock()
+	values := make(map[Key]Value, len(keys))
+	for _, key := range keys {
+		if entry, exists := lru.hash[key]; exists {
+			lru.removeEntry(entry, EvictDeleted)
+			values[key] = entry.value
+		}
+	}
+	return values
+}
+
+func (lru *lruCache) Peek(key Key) (Value, bool) {
+	lru.Lock()
+	defer lru.Unlock()
+	if entry, exists := lru.hash[key]; exists && !entry.deadTime.Before(time.Now()) {
+		return entry.value, true
+	}
+	return nil, false
+}
+
+func (lru *lruCache) Keys() []Key {
+	return snapshotKeys(lru.snapshot())
+}
+
+// Range calls f for the unexpired entries from the coldest to the hottest one
+// until f returns false, f is called without the lock held, so it can access
+// the cache too
+func (lru *lruCache) Range(f func(key Key, value Value) bool) {
+	rangeSnapshot(lru.snapshot(), f)
+}
+
 func (lru *lruCache) Len() int {
 	lru.Lock()
 	defer lru.Unlock()
@@ -128,9 +402,14 @@ func (lru *lruCache) Len() int {
 	}
 	return len(lru.hash)
 }
+
+// Close will stop the background sweeper, and all the remaining keys will be
+// removed with the callback called
 func (lru *lruCache) Close() {
+	lru.closeOnce.Do(func() { close(lru.stop) })
 	lru.Lock()
 	defer lru.Unlock()
-	lru.hash = map[Key]*list.Element{}
-	lru.lst.Init()
+	for _, entry := range lru.hash {
+		lru.removeEntry(entry, EvictClosed)
+	}
 }
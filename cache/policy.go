@@ -0,0 +1,122 @@
+package cache
+
+import "container/list"
+
+// Policy of the cache eviction
+type Policy int
+
+// eviction policies
+const (
+	// PolicyLRU evicts the least recently used key
+	PolicyLRU Policy = iota
+	// PolicyLFU evicts the least frequently used key, the least recently used
+	// one is evicted if there are more than one such keys
+	PolicyLFU
+	// PolicyARC is the adaptive replacement cache, which balances between
+	// the recency and the frequency
+	PolicyARC
+	// PolicyTinyLFU is the W-TinyLFU, a small lru window in front of a
+	// segmented lru guarded by a frequency based admission filter
+	PolicyTinyLFU
+)
+
+func (p Policy) String() string {
+	switch p {
+	case PolicyLRU:
+		return "lru"
+	case PolicyLFU:
+		return "lfu"
+	case PolicyARC:
+		return "arc"
+	case PolicyTinyLFU:
+		return "tinylfu"
+	}
+	return "unknown"
+}
+
+// segment of a policy which the entry belongs to
+type segment uint8
+
+const (
+	segNone segment = iota
+	segWindow
+	segProbation
+	segProtected
+	segT1
+	segT2
+)
+
+// policy decides which entry should be evicted when the cache is full,
+// it is always called with the cache locked
+type policy interface {
+	// add a new entry
+	add(entry *listEntry)
+	// access an existing entry when it is read or updated
+	access(entry *listEntry)
+	// remove an entry which is deleted, expired or evicted
+	remove(entry *listEntry)
+	// victim returns the entry which should be evicted, the policy may move
+	// its entries between the internal segments. The entry just added or
+	// updated is never the victim, so it is readable once the put returns
+	victim(added *listEntry) *listEntry
+	// entries returns all the entries from the coldest to the hottest one
+	entries() []*listEntry
+}
+
+func newPolicy(p Policy, capacity int) policy {
+	switch p {
+	case PolicyLFU:
+		return newLFUPolicy()
+	case PolicyARC:
+		return newARCPolicy(capacity)
+	case PolicyTinyLFU:
+		return newTinyLFUPolicy(capacity)
+	}
+	return newLRUPolicy()
+}
+
+type lruPolicy struct {
+	lst *list.List
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{lst: list.New()}
+}
+
+func (p *lruPolicy) add(entry *listEntry) {
+	entry.elem = p.lst.PushFront(entry)
+}
+
+func (p *lruPolicy) access(entry *listEntry) {
+	p.lst.MoveToFront(entry.elem)
+}
+
+func (p *lruPolicy) remove(entry *listEntry) {
+	p.lst.Remove(entry.elem)
+}
+
+func (p *lruPolicy) victim(added *listEntry) *listEntry {
+	return backExcept(p.lst, added)
+}
+
+func (p *lruPolicy) entries() []*listEntry {
+	return appendBackward(nil, p.lst)
+}
+
+// backExcept returns the entry at the back of the list, but the excepted one
+func backExcept(lst *list.List, except *listEntry) *listEntry {
+	for elem := lst.Back(); elem != nil; elem = elem.Prev() {
+		if entry := elem.Value.(*listEntry); entry != except {
+			return entry
+		}
+	}
+	return nil
+}
+
+// appendBackward appends the entries of the list from the back to the front
+func appendBackward(entries []*listEntry, lst *list.List) []*listEntry {
+	for elem := lst.Back(); elem != nil; elem = elem.Prev() {
+		entries = append(entries, elem.Value.(*listEntry))
+	}
+	return entries
+}
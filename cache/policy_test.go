@@ -0,0 +1,176 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/leopoldxx/go-utils/cache"
+)
+
+var policies = []Policy{PolicyLRU, PolicyLFU, PolicyARC, PolicyTinyLFU}
+
+// the same behavior tests run against every policy
+var policyTests = []struct {
+	name string
+	test func(t *testing.T, policy Policy)
+}{
+	{"PutGetDel", testPolicyPutGetDel},
+	{"Capacity", testPolicyCapacity},
+	{"Expire", testPolicyExpire},
+	{"Close", testPolicyClose},
+	{"HotKeys", testPolicyHotKeys},
+	{"PutFull", testPolicyPutFull},
+}
+
+func TestPolicies(t *testing.T) {
+	for _, policy := range policies {
+		for _, pt := range policyTests {
+			policy, pt := policy, pt
+			t.Run(policy.String()+"/"+pt.name, func(t *testing.T) {
+				pt.test(t, policy)
+			})
+		}
+	}
+}
+
+func testPolicyPutGetDel(t *testing.T, policy Policy) {
+	cache := NewCacheWithConfig(Config{MaxLen: 10, Policy: policy})
+	defer cache.Close()
+
+	cache.Put("testkey1", "testvalue1")
+	if v, ok := cache.Get("testkey1"); !ok || v != "testvalue1" {
+		t.Fatalf("get testkey1 failed, got %v, %v", v, ok)
+	}
+	cache.Put("testkey1", "testvalue2")
+	if v, ok := cache.Get("testkey1"); !ok || v != "testvalue2" {
+		t.Fatalf("get updated testkey1 failed, got %v, %v", v, ok)
+	}
+	if cache.Len() != 1 {
+		t.Fatalf("len failed, expect 1, got %d", cache.Len())
+	}
+	if v := cache.Del("testkey1"); v != "testvalue2" {
+		t.Fatalf("del testkey1 failed, got %v", v)
+	}
+	if _, ok := cache.Get("testkey1"); ok {
+		t.Fatalf("testkey1 should be deleted")
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("len failed, expect 0, got %d", cache.Len())
+	}
+}
+
+func testPolicyCapacity(t *testing.T, policy Policy) {
+	evicted := 0
+	cb := func(key Key, value Value, reason EvictReason) {
+		if reason != EvictCapacity {
+			t.Fatalf("test key %v reason failed, expect %v, got %v", key, EvictCapacity, reason)
+		}
+		evicted++
+	}
+	cache := NewCacheWithConfig(Config{MaxLen: 10, Policy: policy, ReasonCallback: cb})
+
+	for i := 0; i < 100; i++ {
+		cache.Put(i, i)
+		cache.Get(i % 7)
+		if cache.Len() > 10 {
+			t.Fatalf("len failed, expect at most 10, got %d", cache.Len())
+		}
+	}
+	if evicted+cache.Len() != 100 {
+		t.Fatalf("evicted count failed, evicted %d, len %d", evicted, cache.Len())
+	}
+}
+
+func testPolicyExpire(t *testing.T, policy Policy) {
+	cache := NewCacheWithConfig(Config{MaxLen: 10, Policy: policy, CleanupInterval: 100 * time.Millisecond})
+	defer cache.Close()
+
+	cache.PutWithTimeout("testkey1", "testvalue1", time.Second)
+	cache.PutWithTimeout("testkey2", "testvalue2", time.Second)
+	cache.Put("testkey3", "testvalue3")
+	cache.Get("testkey2")
+	time.Sleep(time.Second + 300*time.Millisecond)
+
+	if _, ok := cache.Get("testkey1"); ok {
+		t.Fatalf("testkey1 should be expired")
+	}
+	if cache.Len() != 1 {
+		t.Fatalf("len failed, expect 1, got %d", cache.Len())
+	}
+	// the expired keys should not break the policy
+	for i := 0; i < 20; i++ {
+		cache.Put(i, i)
+	}
+	if cache.Len() != 10 {
+		t.Fatalf("len failed, expect 10, got %d", cache.Len())
+	}
+}
+
+func testPolicyClose(t *testing.T, policy Policy) {
+	closed := 0
+	cb := func(key Key, value Value, reason EvictReason) {
+		if reason == EvictClosed {
+			closed++
+		}
+	}
+	cache := NewCacheWithConfig(Config{MaxLen: 10, Policy: policy, ReasonCallback: cb})
+	for i := 0; i < 5; i++ {
+		cache.Put(i, i)
+	}
+	cache.Close()
+	if closed != 5 || cache.Len() != 0 {
+		t.Fatalf("close failed, closed %d, len %d", closed, cache.Len())
+	}
+}
+
+// the frequently used keys should survive a scan of one-off keys,
+// except the plain lru
+func testPolicyHotKeys(t *testing.T, policy Policy) {
+	if policy == PolicyLRU {
+		t.Skip("lru is not scan resistant")
+	}
+	cache := NewCacheWithConfig(Config{MaxLen: 100, Policy: policy})
+	defer cache.Close()
+
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 20; i++ {
+			if _, ok := cache.Get(i); !ok {
+				cache.Put(i, i)
+			}
+		}
+	}
+	for i := 1000; i < 2000; i++ {
+		cache.Put(i, i)
+	}
+
+	hits := 0
+	for i := 0; i < 20; i++ {
+		if _, ok := cache.Get(i); ok {
+			hits++
+		}
+	}
+	if hits < 18 {
+		t.Fatalf("hot keys failed, expect at least 18 hits, got %d", hits)
+	}
+}
+
+// the key just put is readable even if the cache is full of hot keys
+func testPolicyPutFull(t *testing.T, policy Policy) {
+	cache := NewCacheWithConfig(Config{MaxLen: 2, Policy: policy})
+	defer cache.Close()
+
+	for _, key := range []string{"testkey1", "testkey2"} {
+		cache.Put(key, key)
+		cache.Get(key)
+		cache.Get(key)
+	}
+	for _, key := range []string{"testkey3", "testkey4", "testkey5"} {
+		cache.Put(key, key)
+		if v, ok := cache.Get(key); !ok || v != key {
+			t.Fatalf("test key %s failed, expect %v, got %v", key, key, v)
+		}
+		if cache.Len() != 2 {
+			t.Fatalf("test key %s failed, expect len 2, got %d", key, cache.Len())
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/leopoldxx/go-utils/cache/counter"
+)
+
+type shardedCache struct {
+	seed      maphash.Seed
+	shards    []*lruCache
+	stop      chan struct{}
+	closeOnce sync.Once
+	window    *counter.Counter
+}
+
+func newShardedCache(config Config) *shardedCache {
+	n := config.Shards
+	sc := &shardedCache{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*lruCache, n),
+		stop:   make(chan struct{}),
+	}
+
+	// every shard holds at least one key if the capacity is limited
+	shardConfig := config
+	shardConfig.MaxLen = (config.MaxLen + n - 1) / n
+	shardConfig.MaxCost = (config.MaxCost + int64(n) - 1) / int64(n)
+	// all the shards share one stats window
+	sc.window = newStatsWindow(config, sc.stop)
+	for i := range sc.shards {
+		sc.shards[i] = newLRUCache(shardConfig)
+		sc.shards[i].window = sc.window
+	}
+
+	// one sweeper for all the shards
+	if config.CleanupInterval > 0 {
+		go janitor(config.CleanupInterval, sc.stop, sc.sweep)
+	}
+	return sc
+}
+
+func (sc *shardedCache) shard(key Key) *lruCache {
+	return sc.shards[maphash.Comparable(sc.seed, key)%uint64(len(sc.shards))]
+}
+
+func (sc *shardedCache) sweep() {
+	for _, shard := range sc.shards {
+		shard.sweep()
+	}
+}
+
+func (sc *shardedCache) Put(key Key, value Value) {
+	sc.shard(key).Put(key, value)
+}
+
+func (sc *shardedCache) PutWithTimeout(key Key, value Value, t time.Duration) {
+	sc.shard(key).PutWithTimeout(key, value, t)
+}
+
+func (sc *shardedCache) PutWithTags(key Key, value Value, t time.Duration, tags ...string) {
+	sc.shard(key).PutWithTags(key, value, t, tags...)
+}
+
+func (sc *shardedCache) InvalidateTag(tag string) int {
+	n := 0
+	for _, shard := range sc.shards {
+		n += shard.InvalidateTag(tag)
+	}
+	return n
+}
+
+func (sc *shardedCache) Get(key Key) (Value, bool) {
+	return sc.shard(key).Get(key)
+}
+
+func (sc *shardedCache) Del(key Key) Value {
+	return sc.shard(key).Del(key)
+}
+
+// group the keys by the shards
+func (sc *shardedCache) group(keys []Key) map[*lruCache][]Key {
+	groups := map[*lruCache][]Key{}
+	for _, key := range keys {
+		shard := sc.shard(key)
+		groups[shard] = append(groups[shard], key)
+	}
+	return groups
+}
+
+func (sc *shardedCache) GetMulti(keys []Key) map[Key]Value {
+	values := make(map[Key]Value, len(keys))
+	for shard, keys := range sc.group(keys) {
+		for key, value := range shard.GetMulti(keys) {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+func (sc *shardedCache) PutMulti(values map[Key]Value) {
+	groups := map[*lruCache]map[Key]Value{}
+	for key, value := range values {
+		shard := sc.shard(key)
+		if groups[shard] == nil {
+			groups[shard] = map[Key]Value{}
+		}
+		groups[shard][key] = value
+	}
+	for shard, values := range groups {
+		shard.PutMulti(values)
+	}
+}
+
+func (sc *shardedCache) DelMulti(keys []Key) map[Key]Value {
+	values := make(map[Key]Value, len(keys))
+	for shard, keys := range sc.group(keys) {
+		for key, value := range shard.DelMulti(keys) {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+func (sc *shardedCache) Peek(key Key) (Value, bool) {
+	return sc.shard(key).Peek(key)
+}
+
+func (sc *shardedCache) Keys() []Key {
+	return snapshotKeys(sc.snapshot())
+}
+
+func (sc *shardedCache) Range(f func(key Key, value Value) bool) {
+	for _, shard := range sc.shards {
+		stop := false
+		shard.Range(func(key Key, value Value) bool {
+			stop = !f(key, value)
+			return !stop
+		})
+		if stop {
+			return
+		}
+	}
+}
+
+func (sc *shardedCache) Len() int {
+	n := 0
+	for _, shard := range sc.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+func (sc *shardedCache) Close() {
+	sc.closeOnce.Do(func() { close(sc.stop) })
+	for _, shard := range sc.shards {
+		shard.Close()
+	}
+}
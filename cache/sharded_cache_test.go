@@ -0,0 +1,87 @@
+package cache_test
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/leopoldxx/go-utils/cache"
+)
+
+func TestShardedCache(t *testing.T) {
+	evicted := 0
+	cb := func(key Key, value Value, reason EvictReason) {
+		if reason == EvictCapacity {
+			evicted++
+		}
+	}
+	cache := NewCacheWithConfig(Config{MaxLen: 100, Shards: 4, ReasonCallback: cb})
+	defer cache.Close()
+
+	for i := 0; i < 1000; i++ {
+		cache.Put(i, strconv.Itoa(i))
+		if v, ok := cache.Get(i); !ok || v != strconv.Itoa(i) {
+			t.Fatalf("test key %d failed, got %v, %v", i, v, ok)
+		}
+	}
+	if cache.Len() > 100 {
+		t.Fatalf("len failed, expect at most 100, got %d", cache.Len())
+	}
+	if evicted+cache.Len() != 1000 {
+		t.Fatalf("evicted count failed, evicted %d, len %d", evicted, cache.Len())
+	}
+
+	cache.Put("testkey", "testvalue")
+	if v := cache.Del("testkey"); v != "testvalue" {
+		t.Fatalf("del testkey failed, got %v", v)
+	}
+	if _, ok := cache.Get("testkey"); ok {
+		t.Fatalf("testkey should be deleted")
+	}
+}
+
+func TestShardedCacheCleanup(t *testing.T) {
+	cache := NewCacheWithConfig(Config{MaxLen: 100, Shards: 4, CleanupInterval: 100 * time.Millisecond})
+	for i := 0; i < 10; i++ {
+		cache.PutWithTimeout(i, i, time.Second)
+	}
+	time.Sleep(time.Second + 300*time.Millisecond)
+	if cache.Len() != 0 {
+		t.Fatalf("len failed, expect 0, got %d", cache.Len())
+	}
+	cache.Close()
+}
+
+func benchmarkCache(b *testing.B, config Config) {
+	cache := NewCacheWithConfig(config)
+	defer cache.Close()
+
+	const keys = 10000
+	for i := 0; i < keys; i++ {
+		cache.Put(i, i)
+	}
+	b.ResetTimer()
+	var seed int64
+	b.RunParallel(func(pb *testing.PB) {
+		// every goroutine walks the keys from a different start point
+		i := int(atomic.AddInt64(&seed, 1)) * 7919
+		for pb.Next() {
+			// 90% get, 10% put
+			if i%10 == 0 {
+				cache.Put(i%keys, i)
+			} else {
+				cache.Get(i % keys)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkLRUCache(b *testing.B) {
+	benchmarkCache(b, Config{MaxLen: DefaultMaxLen})
+}
+
+func BenchmarkShardedCache(b *testing.B) {
+	benchmarkCache(b, Config{MaxLen: DefaultMaxLen, Shards: 32})
+}
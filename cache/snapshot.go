@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/leopoldxx/go-utils/errors"
+)
+
+// Encoder encodes the snapshot entries one by one
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder decodes the snapshot entries one by one, io.EOF is returned at the end
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Codec of the snapshot
+type Codec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+type gobCodec struct{}
+
+func (gobCodec) NewEncoder(w io.Writer) Encoder { return gob.NewEncoder(w) }
+func (gobCodec) NewDecoder(r io.Reader) Decoder { return gob.NewDecoder(r) }
+
+type jsonCodec struct{}
+
+func (jsonCodec) NewEncoder(w io.Writer) Encoder { return json.NewEncoder(w) }
+func (jsonCodec) NewDecoder(r io.Reader) Decoder { return json.NewDecoder(r) }
+
+// codecs
+var (
+	// GobCodec encodes the entries with encoding/gob, the concrete types of
+	// the keys and values must be registered by gob.Register
+	GobCodec Codec = gobCodec{}
+	// JSONCodec encodes the entries with encoding/json, the keys and values
+	// are restored as the generic json types, such as float64 and
+	// map[string]interface{}, use Typed to restore the concrete types
+	JSONCodec Codec = jsonCodec{}
+)
+
+// Snapshotter can save the cached entries and restore them, for warm restarts
+type Snapshotter interface {
+	// Snapshot writes the entries from the coldest to the hottest one
+	Snapshot(w io.Writer, codec Codec) error
+	// Restore puts the entries with the remaining cache time and their tags,
+	// the entries which are already expired are skipped. It returns the number
+	// of restored entries
+	Restore(r io.Reader, codec Codec) (int, error)
+}
+
+var errNoSnapshot = errors.New("the cache does not support snapshot")
+
+type snapshotEntry[K comparable, V any] struct {
+	Key      K
+	Value    V
+	DeadTime time.Time
+	Tags     []string `json:",omitempty"`
+}
+
+// snapshotSource is implemented by the caches which can be snapshotted
+type snapshotSource interface {
+	snapshot() []snapshotEntry[Key, Value]
+}
+
+func (lru *lruCache) snapshot() []snapshotEntry[Key, Value] {
+	lru.Lock()
+	defer lru.Unlock()
+	now := time.Now()
+	entries := lru.policy.entries()
+	snapshot := make([]snapshotEntry[Key, Value], 0, len(entries))
+	for _, entry := range entries {
+		if entry.deadTime.Before(now) {
+			continue
+		}
+		snapshot = append(snapshot, snapshotEntry[Key, Value]{entry.key, entry.value, entry.deadTime, entry.tags})
+	}
+	return snapshot
+}
+
+func (sc *shardedCache) snapshot() []snapshotEntry[Key, Value] {
+	var snapshot []snapshotEntry[Key, Value]
+	for _, shard := range sc.shards {
+		snapshot = append(snapshot, shard.snapshot()...)
+	}
+	return snapshot
+}
+
+func snapshotKeys(snapshot []snapshotEntry[Key, Value]) []Key {
+	keys := make([]Key, 0, len(snapshot))
+	for _, entry := range snapshot {
+		keys = append(keys, entry.Key)
+	}
+	return keys
+}
+
+func rangeSnapshot(snapshot []snapshotEntry[Key, Value], f func(key Key, value Value) bool) {
+	for _, entry := range snapshot {
+		if !f(entry.Key, entry.Value) {
+			return
+		}
+	}
+}
+
+func (lru *lruCache) Snapshot(w io.Writer, codec Codec) error {
+	return encodeSnapshot(codec.NewEncoder(w), lru.snapshot())
+}
+
+func (lru *lruCache) Restore(r io.Reader, codec Codec) (int, error) {
+	return restoreSnapshot[Key, Value](codec.NewDecoder(r), lru.PutWithTags)
+}
+
+func (sc *shardedCache) Snapshot(w io.Writer, codec Codec) error {
+	return encodeSnapshot(codec.NewEncoder(w), sc.snapshot())
+}
+
+func (sc *shardedCache) Restore(r io.Reader, codec Codec) (int, error) {
+	return restoreSnapshot[Key, Value](codec.NewDecoder(r), sc.PutWithTags)
+}
+
+// Snapshot writes the entries from the coldest to the hottest one
+func (t *Typed[K, V]) Snapshot(w io.Writer, codec Codec) error {
+	source, ok := t.c.(snapshotSource)
+	if !ok {
+		return errNoSnapshot
+	}
+	entries := source.snapshot()
+	snapshot := make([]snapshotEntry[K, V], 0, len(entries))
+	for _, entry := range entries {
+		key, _ := entry.Key.(K)
+		value, _ := entry.Value.(V)
+		snapshot = append(snapshot, snapshotEntry[K, V]{key, value, entry.DeadTime, entry.Tags})
+	}
+	return encodeSnapshot(codec.NewEncoder(w), snapshot)
+}
+
+// Restore puts the entries with the remaining cache time and their tags,
+// the entries which are already expired are skipped. It returns the number
+// of restored entries
+func (t *Typed[K, V]) Restore(r io.Reader, codec Codec) (int, error) {
+	return restoreSnapshot(codec.NewDecoder(r), t.PutWithTags)
+}
+
+func encodeSnapshot[K comparable, V any](enc Encoder, snapshot []snapshotEntry[K, V]) error {
+	for idx := range snapshot {
+		if err := enc.Encode(&snapshot[idx]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreSnapshot[K comparable, V any](dec Decoder, put func(key K, value V, t time.Duration, tags ...string)) (int, error) {
+	n := 0
+	for {
+		var entry snapshotEntry[K, V]
+		if err := dec.Decode(&entry); err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		// expired while the process was down
+		ttl := time.Until(entry.DeadTime)
+		if ttl <= 0 {
+			continue
+		}
+		put(entry.Key, entry.Value, ttl, entry.Tags...)
+		n++
+	}
+}
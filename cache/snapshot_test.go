@@ -0,0 +1,118 @@
+package cache_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/leopoldxx/go-utils/cache"
+)
+
+func TestSnapshot(t *testing.T) {
+	codecs := map[string]Codec{"gob": GobCodec, "json": JSONCodec}
+	for name, codec := range codecs {
+		for _, shards := range []int{0, 4} {
+			// only the single lru keeps the order of all the keys
+			config := Config{MaxLen: 3}
+			if shards > 0 {
+				config = Config{MaxLen: 100, Shards: shards}
+			}
+			cache := NewCacheWithConfig(config)
+			cache.Put("testkey1", "testvalue1")
+			cache.Put("testkey2", "testvalue2")
+			cache.PutWithTimeout("testkey3", "testvalue3", time.Second)
+			cache.Get("testkey1")
+
+			var buf bytes.Buffer
+			if err := cache.(Snapshotter).Snapshot(&buf, codec); err != nil {
+				t.Fatalf("snapshot with %s failed: %v", name, err)
+			}
+			cache.Close()
+
+			// testkey3 is expired while restarting
+			time.Sleep(time.Second + 100*time.Millisecond)
+
+			restored := NewCacheWithConfig(config)
+			n, err := restored.(Snapshotter).Restore(&buf, codec)
+			if err != nil || n != 2 {
+				t.Fatalf("restore with %s failed, got %d, %v", name, n, err)
+			}
+			// peek does not change the restored order
+			if v, ok := restored.Peek("testkey2"); !ok || v != "testvalue2" {
+				t.Fatalf("peek restored testkey2 with %s failed, got %v, %v", name, v, ok)
+			}
+			if _, ok := restored.Peek("testkey3"); ok {
+				t.Fatalf("testkey3 should not be restored with %s", name)
+			}
+			if shards == 0 {
+				// the lru order is kept, testkey2 is older than testkey1
+				restored.Put("testkey4", "testvalue4")
+				restored.Put("testkey5", "testvalue5")
+				if _, ok := restored.Peek("testkey2"); ok {
+					t.Fatalf("testkey2 should be evicted with %s", name)
+				}
+				if _, ok := restored.Peek("testkey1"); !ok {
+					t.Fatalf("testkey1 should be kept with %s", name)
+				}
+			}
+			restored.Close()
+		}
+	}
+}
+
+func TestSnapshotTags(t *testing.T) {
+	codecs := map[string]Codec{"gob": GobCodec, "json": JSONCodec}
+	for name, codec := range codecs {
+		for _, shards := range []int{0, 4} {
+			config := Config{MaxLen: 100, Shards: shards}
+			cache := NewCacheWithConfig(config)
+			cache.PutWithTags("testkey1", "testvalue1", time.Minute, "testtag1", "testtag2")
+			cache.PutWithTags("testkey2", "testvalue2", time.Minute, "testtag2")
+			cache.Put("testkey3", "testvalue3")
+
+			var buf bytes.Buffer
+			if err := cache.(Snapshotter).Snapshot(&buf, codec); err != nil {
+				t.Fatalf("snapshot with %s failed: %v", name, err)
+			}
+			cache.Close()
+
+			restored := NewCacheWithConfig(config)
+			if n, err := restored.(Snapshotter).Restore(&buf, codec); err != nil || n != 3 {
+				t.Fatalf("restore with %s failed, got %d, %v", name, n, err)
+			}
+			// the tags are restored with the entries
+			if n := restored.InvalidateTag("testtag2"); n != 2 {
+				t.Fatalf("invalidate testtag2 with %s failed, expect 2, got %d", name, n)
+			}
+			if _, ok := restored.Peek("testkey3"); !ok || restored.Len() != 1 {
+				t.Fatalf("testkey3 should be kept with %s", name)
+			}
+			restored.Close()
+		}
+	}
+}
+
+func TestTypedSnapshot(t *testing.T) {
+	type value struct {
+		Name  string
+		Count int
+	}
+	cache := NewTypedWithConfig[int, value](Config{MaxLen: 10})
+	cache.Put(1, value{"one", 1})
+	cache.Put(2, value{"two", 2})
+
+	var buf bytes.Buffer
+	if err := cache.Snapshot(&buf, JSONCodec); err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	cache.Close()
+
+	restored := NewTypedWithConfig[int, value](Config{MaxLen: 10})
+	defer restored.Close()
+	if n, err := restored.Restore(&buf, JSONCodec); err != nil || n != 2 {
+		t.Fatalf("restore failed, got %d, %v", n, err)
+	}
+	if v, ok := restored.Get(2); !ok || v.Name != "two" || v.Count != 2 {
+		t.Fatalf("get restored key failed, got %v, %v", v, ok)
+	}
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/leopoldxx/go-utils/cache/counter"
+	"github.com/leopoldxx/go-utils/trace"
+)
+
+// consts
+const (
+	DefaultStatsWindow = 10
+)
+
+// Stats of the cache
+type Stats struct {
+	// Len is the current number of the cached keys
+	Len int
+	// Cost is the current total cost of the cached values
+	Cost int64
+	// Hits & Misses of the cache lifetime
+	Hits     int64
+	Misses   int64
+	HitRatio float64
+	// WindowHits & WindowMisses of the recent StatsWindow intervals, they are
+	// only available if Config.StatsInterval is set
+	WindowHits     int64
+	WindowMisses   int64
+	WindowHitRatio float64
+	// Evictions by the reasons
+	Evictions map[EvictReason]int64
+	// Expirations is the number of the expired keys
+	Expirations int64
+	// NegativeHits & NegativeEntries of the cached not found errors, they are
+	// only available for the LoadingCache with NegativeTTL
+	NegativeHits    int64
+	NegativeEntries int
+}
+
+func (s Stats) String() string {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "len=[%d] cost=[%d] hits=[%d] misses=[%d] hit_ratio=[%.4f] ", s.Len, s.Cost, s.Hits, s.Misses, s.HitRatio)
+	fmt.Fprintf(&buffer, "window_hits=[%d] window_misses=[%d] window_hit_ratio=[%.4f] ", s.WindowHits, s.WindowMisses, s.WindowHitRatio)
+	buffer.WriteString("evictions=[")
+	for reason := EvictReason(0); reason < numEvictReasons; reason++ {
+		if reason != 0 {
+			buffer.WriteString(",")
+		}
+		fmt.Fprintf(&buffer, "%s:%d", reason, s.Evictions[reason])
+	}
+	fmt.Fprintf(&buffer, "] expirations=[%d] ", s.Expirations)
+	fmt.Fprintf(&buffer, "negative_hits=[%d] negative_entries=[%d]", s.NegativeHits, s.NegativeEntries)
+	return buffer.String()
+}
+
+// LogStats will log the stats of the cache with the trace of the ctx
+func LogStats(ctx context.Context, name string, c Cache) {
+	trace.GetTraceFromContext(ctx).Infof("event=[cache-stats] cache=[%s] %s", name, c.Stats())
+}
+
+func ratio(hits, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// newStatsWindow creates the window counter if it is enabled, and advances it
+// until the stop chan is closed
+func newStatsWindow(config Config, stop <-chan struct{}) *counter.Counter {
+	if config.StatsInterval <= 0 {
+		return nil
+	}
+	n := config.StatsWindow
+	if n == 0 {
+		n = DefaultStatsWindow
+	}
+	window := counter.New(n)
+	window.AutoAdvance(config.StatsInterval, stop)
+	return window
+}
+
+func (lru *lruCache) hit() {
+	lru.hits++
+	if lru.window != nil {
+		lru.window.Hit()
+	}
+}
+
+func (lru *lruCache) miss() {
+	lru.misses++
+	if lru.window != nil {
+		lru.window.Miss()
+	}
+}
+
+func (lru *lruCache) Stats() Stats {
+	lru.Lock()
+	s := Stats{
+		Len:       len(lru.hash),
+		Cost:      lru.cost,
+		Hits:      lru.hits,
+		Misses:    lru.misses,
+		Evictions: make(map[EvictReason]int64, numEvictReasons),
+	}
+	for reason, n := range lru.evictions {
+		s.Evictions[EvictReason(reason)] = n
+	}
+	lru.Unlock()
+
+	s.fill(lru.window)
+	return s
+}
+
+func (sc *shardedCache) Stats() Stats {
+	s := Stats{Evictions: make(map[EvictReason]int64, numEvictReasons)}
+	for _, shard := range sc.shards {
+		ss := shard.Stats()
+		s.Len += ss.Len
+		s.Cost += ss.Cost
+		s.Hits += ss.Hits
+		s.Misses += ss.Misses
+		for reason, n := range ss.Evictions {
+			s.Evictions[reason] += n
+		}
+	}
+	s.fill(sc.window)
+	return s
+}
+
+// fill the calculated fields
+func (s *Stats) fill(window *counter.Counter) {
+	s.HitRatio = ratio(s.Hits, s.Misses)
+	s.Expirations = s.Evictions[EvictExpired]
+	if window != nil {
+		s.WindowHits, s.WindowMisses = window.Value()
+		s.WindowHitRatio = ratio(s.WindowHits, s.WindowMisses)
+	}
+}
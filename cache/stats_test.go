@@ -0,0 +1,50 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/leopoldxx/go-utils/cache"
+)
+
+func TestStats(t *testing.T) {
+	for _, shards := range []int{0, 4} {
+		// every shard is large enough for the keys, which are sharded randomly
+		cache := NewCacheWithConfig(Config{MaxLen: 2 * max(shards, 1), Shards: shards, StatsInterval: 100 * time.Millisecond, StatsWindow: 2})
+
+		cache.Put("testkey1", "testvalue1")
+		cache.PutWithTimeout("testkey2", "testvalue2", time.Second)
+		cache.Get("testkey1")
+		cache.Get("testkey1")
+		cache.Get("testkey3")
+		cache.Del("testkey1")
+
+		s := cache.Stats()
+		t.Log(s)
+		if s.Len != 1 || s.Hits != 2 || s.Misses != 1 || s.HitRatio < 0.66 || s.HitRatio > 0.67 {
+			t.Fatalf("stats of shards %d failed, got %+v", shards, s)
+		}
+		if s.WindowHits != 2 || s.WindowMisses != 1 {
+			t.Fatalf("window stats of shards %d failed, got %+v", shards, s)
+		}
+		if s.Evictions[EvictDeleted] != 1 {
+			t.Fatalf("evictions of shards %d failed, got %+v", shards, s)
+		}
+
+		time.Sleep(time.Second + 100*time.Millisecond)
+		cache.Get("testkey2")
+		s = cache.Stats()
+		t.Log(s)
+		if s.Len != 0 || s.Expirations != 1 || s.Misses != 2 {
+			t.Fatalf("stats of shards %d failed, got %+v", shards, s)
+		}
+		// the window has moved forward
+		if s.WindowHits != 0 || s.WindowMisses != 1 {
+			t.Fatalf("window stats of shards %d failed, got %+v", shards, s)
+		}
+
+		LogStats(context.Background(), "test", cache)
+		cache.Close()
+	}
+}
@@ -0,0 +1,46 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/leopoldxx/go-utils/cache"
+)
+
+func TestInvalidateTag(t *testing.T) {
+	for _, shards := range []int{0, 4} {
+		reasons := map[Key]EvictReason{}
+		cb := func(key Key, value Value, reason EvictReason) {
+			reasons[key] = reason
+		}
+		cache := NewCacheWithConfig(Config{MaxLen: 100, Shards: shards, ReasonCallback: cb})
+
+		cache.PutWithTags("user:1", "value1", time.Minute, "tenant:a", "table:user")
+		cache.PutWithTags("user:2", "value2", time.Minute, "tenant:b", "table:user")
+		cache.PutWithTags("order:1", "value3", time.Minute, "tenant:a", "table:order")
+		cache.Put("other", "value4")
+
+		if n := cache.InvalidateTag("tenant:a"); n != 2 {
+			t.Fatalf("invalidate tenant:a of shards %d failed, expect 2, got %d", shards, n)
+		}
+		if reasons["user:1"] != EvictInvalidated || reasons["order:1"] != EvictInvalidated {
+			t.Fatalf("reasons of shards %d failed, got %v", shards, reasons)
+		}
+		if cache.Len() != 2 {
+			t.Fatalf("len of shards %d failed, expect 2, got %d", shards, cache.Len())
+		}
+
+		// the tags are replaced by the later put
+		cache.Put("user:2", "value2")
+		if n := cache.InvalidateTag("table:user"); n != 0 {
+			t.Fatalf("invalidate table:user of shards %d failed, expect 0, got %d", shards, n)
+		}
+		if n := cache.InvalidateTag("not-exist"); n != 0 {
+			t.Fatalf("invalidate not-exist of shards %d failed, expect 0, got %d", shards, n)
+		}
+		if cache.Len() != 2 {
+			t.Fatalf("len of shards %d failed, expect 2, got %d", shards, cache.Len())
+		}
+		cache.Close()
+	}
+}
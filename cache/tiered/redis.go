@@ -0,0 +1,244 @@
+package tiered
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// consts
+const (
+	DefaultRedisPoolSize    = 10
+	DefaultRedisDialTimeout = time.Second
+	DefaultRedisTimeout     = 3 * time.Second
+)
+
+// RedisConfig of the redis store
+type RedisConfig struct {
+	Addr        string
+	Password    string
+	DB          int
+	PoolSize    int
+	DialTimeout time.Duration
+	// Timeout of reading & writing a command if the context has no deadline
+	Timeout time.Duration
+}
+
+// RedisStore is a RemoteStore speaking the redis protocol (RESP)
+type RedisStore struct {
+	config RedisConfig
+	pool   chan *redisConn
+}
+
+// NewRedisStore creates a redis store, the connections are dialed lazily
+func NewRedisStore(config RedisConfig) *RedisStore {
+	if config.PoolSize <= 0 {
+		config.PoolSize = DefaultRedisPoolSize
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = DefaultRedisDialTimeout
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultRedisTimeout
+	}
+	return &RedisStore{
+		config: config,
+		pool:   make(chan *redisConn, config.PoolSize),
+	}
+}
+
+// Get the value of the key
+func (rs *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := rs.do(ctx, "GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected reply %v of GET", reply)
+	}
+	return data, true, nil
+}
+
+// Set the value of the key with the ttl
+func (rs *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{key, string(value)}
+	if ms := ttl.Milliseconds(); ms > 0 {
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	_, err := rs.do(ctx, "SET", args...)
+	return err
+}
+
+// Del the key
+func (rs *RedisStore) Del(ctx context.Context, key string) error {
+	_, err := rs.do(ctx, "DEL", key)
+	return err
+}
+
+// Close all the idle connections
+func (rs *RedisStore) Close() {
+	for {
+		select {
+		case conn := <-rs.pool:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// redisError is the error reply of the redis server
+type redisError string
+
+func (err redisError) Error() string {
+	return "redis: " + string(err)
+}
+
+type redisConn struct {
+	net.Conn
+	br      *bufio.Reader
+	bw      *bufio.Writer
+	timeout time.Duration
+}
+
+func (rs *RedisStore) do(ctx context.Context, cmd string, args ...string) (interface{}, error) {
+	conn, err := rs.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(ctx, cmd, args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		// the connection is broken
+		conn.Close()
+		return nil, err
+	}
+	rs.put(conn)
+	return reply, err
+}
+
+func (rs *RedisStore) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-rs.pool:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: rs.config.DialTimeout}
+	c, err := dialer.DialContext(ctx, "tcp", rs.config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: c, br: bufio.NewReader(c), bw: bufio.NewWriter(c), timeout: rs.config.Timeout}
+	if len(rs.config.Password) > 0 {
+		if _, err := conn.do(ctx, "AUTH", rs.config.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if rs.config.DB != 0 {
+		if _, err := conn.do(ctx, "SELECT", strconv.Itoa(rs.config.DB)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (rs *RedisStore) put(conn *redisConn) {
+	select {
+	case rs.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (conn *redisConn) do(ctx context.Context, cmd string, args ...string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(conn.timeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	// a command is an array of bulk strings
+	fmt.Fprintf(conn.bw, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(cmd), cmd)
+	for _, arg := range args {
+		fmt.Fprintf(conn.bw, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := conn.bw.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(conn.br)
+}
+
+// readReply reads a RESP reply, the bulk strings are returned as []byte,
+// and the nil bulk string as nil. The first error reply nested in an array
+// is returned after the whole array is read
+func readReply(br *bufio.Reader) (interface{}, error) {
+	line, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		var replyErr error
+		replies := make([]interface{}, n)
+		for i := range replies {
+			if replies[i], err = readReply(br); err != nil {
+				if _, ok := err.(redisError); !ok {
+					return nil, err
+				}
+				if replyErr == nil {
+					replyErr = err
+				}
+			}
+		}
+		return replies, replyErr
+	}
+	return nil, fmt.Errorf("redis: invalid reply %q", line)
+}
+
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: invalid line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
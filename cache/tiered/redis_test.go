@@ -0,0 +1,163 @@
+package tiered
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-process RESP server which supports GET, SET & DEL
+type fakeRedis struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	data map[string]string
+	dead map[string]time.Time
+	gets int
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen failed:", err)
+	}
+	fr := &fakeRedis{ln: ln, data: map[string]string{}, dead: map[string]time.Time{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go fr.serve(conn)
+		}
+	}()
+	return fr
+}
+
+func (fr *fakeRedis) addr() string {
+	return fr.ln.Addr().String()
+}
+
+func (fr *fakeRedis) close() {
+	fr.ln.Close()
+}
+
+func (fr *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for {
+		req, err := readReply(br)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range req.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+		conn.Write([]byte(fr.exec(args)))
+	}
+}
+
+func (fr *fakeRedis) exec(args []string) string {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	switch args[0] {
+	case "GET":
+		fr.gets++
+		value, ok := fr.data[args[1]]
+		if dead, exists := fr.dead[args[1]]; !ok || (exists && dead.Before(time.Now())) {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		fr.data[args[1]] = args[2]
+		delete(fr.dead, args[1])
+		if len(args) == 5 && args[3] == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			fr.dead[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "DEL":
+		_, ok := fr.data[args[1]]
+		delete(fr.data, args[1])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "HANG":
+		// no reply
+		return ""
+	case "NESTED":
+		return "*2\r\n+OK\r\n-ERR nested\r\n"
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func TestRedisStore(t *testing.T) {
+	fr := newFakeRedis(t)
+	defer fr.close()
+	rs := NewRedisStore(RedisConfig{Addr: fr.addr(), PoolSize: 2})
+	defer rs.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, ok, err := rs.Get(ctx, "testkey"); err != nil || ok {
+		t.Fatalf("get not exist key failed, got %v, %v", ok, err)
+	}
+	if err := rs.Set(ctx, "testkey", []byte("test\r\nvalue"), 100*time.Millisecond); err != nil {
+		t.Fatal("set testkey failed:", err)
+	}
+	if data, ok, err := rs.Get(ctx, "testkey"); err != nil || !ok || string(data) != "test\r\nvalue" {
+		t.Fatalf("get testkey failed, got %q, %v, %v", data, ok, err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if _, ok, err := rs.Get(ctx, "testkey"); err != nil || ok {
+		t.Fatalf("testkey should be expired, got %v, %v", ok, err)
+	}
+
+	rs.Set(ctx, "testkey", []byte("testvalue"), 0)
+	if err := rs.Del(ctx, "testkey"); err != nil {
+		t.Fatal("del testkey failed:", err)
+	}
+	if _, ok, _ := rs.Get(ctx, "testkey"); ok {
+		t.Fatal("testkey should be deleted")
+	}
+
+	// the error reply does not break the connection
+	if _, err := rs.do(ctx, "PING"); err == nil {
+		t.Fatal("unknown command should be failed")
+	}
+	if _, _, err := rs.Get(ctx, "testkey"); err != nil {
+		t.Fatal("get after the error reply failed:", err)
+	}
+
+	// the error reply nested in an array is returned
+	if _, err := rs.do(ctx, "NESTED"); err == nil || err.Error() != "redis: ERR nested" {
+		t.Fatalf("nested error reply failed, got %v", err)
+	}
+	if _, _, err := rs.Get(ctx, "testkey"); err != nil {
+		t.Fatal("get after the nested error reply failed:", err)
+	}
+}
+
+func TestRedisStoreTimeout(t *testing.T) {
+	fr := newFakeRedis(t)
+	defer fr.close()
+	rs := NewRedisStore(RedisConfig{Addr: fr.addr(), Timeout: 100 * time.Millisecond})
+	defer rs.Close()
+
+	// the default timeout is used if the context has no deadline
+	start := time.Now()
+	if _, err := rs.do(context.Background(), "HANG"); err == nil {
+		t.Fatal("hung command should be timed out")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("hung command timed out too late, got %v", d)
+	}
+}
@@ -0,0 +1,171 @@
+// Package tiered is a two-tier cache, the in-process cache in front of a
+// shared remote store
+package tiered
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/leopoldxx/go-utils/cache"
+	"github.com/leopoldxx/go-utils/trace"
+)
+
+// RemoteStore is the shared remote tier of the cache
+type RemoteStore interface {
+	// Get returns false if the key is not found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Del(ctx context.Context, key string) error
+}
+
+// Codec encodes the values stored in the remote tier
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// Loader loads the value when it is missed in both tiers
+type Loader[V any] func(ctx context.Context, key string) (V, error)
+
+// Option func for the tiered cache
+type Option func(opts *options)
+
+type options struct {
+	codec     Codec
+	localTTL  time.Duration
+	remoteTTL time.Duration
+}
+
+// WithCodec sets the codec of the remote values, json is used by default
+func WithCodec(codec Codec) Option {
+	return func(opts *options) {
+		opts.codec = codec
+	}
+}
+
+// LocalTTL sets the cache time of the local tier
+func LocalTTL(ttl time.Duration) Option {
+	return func(opts *options) {
+		opts.localTTL = ttl
+	}
+}
+
+// RemoteTTL sets the cache time of the remote tier
+func RemoteTTL(ttl time.Duration) Option {
+	return func(opts *options) {
+		opts.remoteTTL = ttl
+	}
+}
+
+// consts
+const (
+	DefaultLocalTTL  = time.Minute
+	DefaultRemoteTTL = 10 * time.Minute
+)
+
+// Cache is a two-tier cache, misses fall through the local tier, then the
+// remote tier, then the loader, and the loaded values populate both tiers
+type Cache[V any] struct {
+	local  *cache.LoadingCache
+	remote RemoteStore
+	opts   options
+}
+
+// New creates a two-tier cache, the local tier is created with the config
+func New[V any](config cache.Config, remote RemoteStore, opts ...Option) *Cache[V] {
+	c := &Cache[V]{
+		remote: remote,
+		opts: options{
+			codec:     jsonCodec{},
+			localTTL:  DefaultLocalTTL,
+			remoteTTL: DefaultRemoteTTL,
+		},
+	}
+	for idx := range opts {
+		opts[idx](&c.opts)
+	}
+	// the concurrent misses of one key only reach the remote tier once
+	c.local = cache.NewLoadingCache(config, cache.LoadTTL(c.opts.localTTL))
+	return c
+}
+
+// Get returns the value of the key from the first tier which has it, or loads
+// it by the loader
+func (c *Cache[V]) Get(ctx context.Context, key string, loader Loader[V]) (V, error) {
+	v, err := c.local.GetOrLoad(ctx, key, func(ctx context.Context, _ cache.Key) (cache.Value, error) {
+		if value, ok := c.getRemote(ctx, key); ok {
+			return value, nil
+		}
+		value, err := loader(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		c.setRemote(ctx, key, value)
+		return value, nil
+	})
+	value, _ := v.(V)
+	return value, err
+}
+
+// Set the value to both tiers
+func (c *Cache[V]) Set(ctx context.Context, key string, value V) error {
+	data, err := c.opts.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := c.remote.Set(ctx, key, data, c.opts.remoteTTL); err != nil {
+		return err
+	}
+	c.local.Put(key, value)
+	return nil
+}
+
+// Del the key from both tiers
+func (c *Cache[V]) Del(ctx context.Context, key string) error {
+	c.local.Del(key)
+	return c.remote.Del(ctx, key)
+}
+
+// Stats of the local tier
+func (c *Cache[V]) Stats() cache.Stats {
+	return c.local.Stats()
+}
+
+// Close the local tier
+func (c *Cache[V]) Close() {
+	c.local.Close()
+}
+
+// the failures of the remote tier are logged, and the cache falls through
+func (c *Cache[V]) getRemote(ctx context.Context, key string) (V, bool) {
+	var value V
+	data, ok, err := c.remote.Get(ctx, key)
+	if err != nil {
+		trace.GetTraceFromContext(ctx).Warnf("event=[cache-remote-get-failed] key=[%s] err=[%v]", key, err)
+		return value, false
+	}
+	if !ok {
+		return value, false
+	}
+	if err := c.opts.codec.Unmarshal(data, &value); err != nil {
+		trace.GetTraceFromContext(ctx).Warnf("event=[cache-remote-decode-failed] key=[%s] err=[%v]", key, err)
+		return value, false
+	}
+	return value, true
+}
+
+func (c *Cache[V]) setRemote(ctx context.Context, key string, value V) {
+	data, err := c.opts.codec.Marshal(value)
+	if err == nil {
+		err = c.remote.Set(ctx, key, data, c.opts.remoteTTL)
+	}
+	if err != nil {
+		trace.GetTraceFromContext(ctx).Warnf("event=[cache-remote-set-failed] key=[%s] err=[%v]", key, err)
+	}
+}
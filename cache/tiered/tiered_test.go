@@ -0,0 +1,76 @@
+package tiered
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/leopoldxx/go-utils/cache"
+	"github.com/leopoldxx/go-utils/errors"
+)
+
+type user struct {
+	ID   int
+	Name string
+}
+
+func TestTiered(t *testing.T) {
+	fr := newFakeRedis(t)
+	defer fr.close()
+	rs := NewRedisStore(RedisConfig{Addr: fr.addr()})
+	defer rs.Close()
+
+	var loads int32
+	loader := func(ctx context.Context, key string) (user, error) {
+		atomic.AddInt32(&loads, 1)
+		if key == "missing" {
+			return user{}, errors.NewNotFoundError(key)
+		}
+		return user{ID: 1, Name: key}, nil
+	}
+
+	ctx := context.Background()
+	c1 := New[user](cache.Config{MaxLen: 10}, rs)
+	defer c1.Close()
+	c2 := New[user](cache.Config{MaxLen: 10}, rs)
+	defer c2.Close()
+
+	// missed in both tiers
+	if u, err := c1.Get(ctx, "alice", loader); err != nil || u.Name != "alice" {
+		t.Fatalf("get alice failed, got %v, %v", u, err)
+	}
+	// hit in the local tier
+	if u, err := c1.Get(ctx, "alice", loader); err != nil || u.Name != "alice" || fr.gets != 1 {
+		t.Fatalf("get alice from the local tier failed, got %v, %v, remote gets %d", u, err, fr.gets)
+	}
+	// hit in the remote tier
+	if u, err := c2.Get(ctx, "alice", loader); err != nil || u.Name != "alice" || loads != 1 {
+		t.Fatalf("get alice from the remote tier failed, got %v, %v, loads %d", u, err, loads)
+	}
+
+	if _, err := c1.Get(ctx, "missing", loader); !errors.IsNotFoundError(err) {
+		t.Fatalf("get missing should be not found, got %v", err)
+	}
+
+	if err := c1.Set(ctx, "bob", user{ID: 2, Name: "bob"}); err != nil {
+		t.Fatal("set bob failed:", err)
+	}
+	if u, err := c2.Get(ctx, "bob", loader); err != nil || u.ID != 2 {
+		t.Fatalf("get bob failed, got %v, %v", u, err)
+	}
+	if err := c1.Del(ctx, "bob"); err != nil {
+		t.Fatal("del bob failed:", err)
+	}
+	if _, ok, _ := rs.Get(ctx, "bob"); ok {
+		t.Fatal("bob should be deleted from the remote tier")
+	}
+
+	// the loader is still used if the remote tier is down
+	fr.close()
+	rs.Close()
+	c3 := New[user](cache.Config{MaxLen: 10}, rs)
+	defer c3.Close()
+	if u, err := c3.Get(ctx, "carol", loader); err != nil || u.Name != "carol" {
+		t.Fatalf("get carol failed, got %v, %v", u, err)
+	}
+}
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+)
+
+// tinyLFUPolicy is the W-TinyLFU:
+// new entries go into a small lru window, the entries leaving the window
+// become candidates of the main segmented lru (probation & protected), and
+// a candidate is only admitted if it is more frequent than the victim of
+// the main segment
+type tinyLFUPolicy struct {
+	window    *list.List
+	probation *list.List
+	protected *list.List
+
+	windowCap    int
+	protectedCap int
+
+	sketch    *countMinSketch
+	candidate *listEntry
+}
+
+func newTinyLFUPolicy(capacity int) *tinyLFUPolicy {
+	windowCap := max(capacity/100, 1)
+	return &tinyLFUPolicy{
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		windowCap:    windowCap,
+		protectedCap: (capacity - windowCap) * 8 / 10,
+		sketch:       newCountMinSketch(capacity),
+	}
+}
+
+func (p *tinyLFUPolicy) add(entry *listEntry) {
+	p.sketch.increment(entry.key)
+	p.pushFront(p.window, segWindow, entry)
+	for p.window.Len() > p.windowCap {
+		// the oldest one of the window is the candidate of the main segment
+		candidate := p.window.Back().Value.(*listEntry)
+		p.unlink(candidate)
+		p.pushFront(p.probation, segProbation, candidate)
+		p.candidate = candidate
+	}
+}
+
+func (p *tinyLFUPolicy) access(entry *listEntry) {
+	p.sketch.increment(entry.key)
+	switch entry.seg {
+	case segWindow:
+		p.window.MoveToFront(entry.elem)
+	case segProtected:
+		p.protected.MoveToFront(entry.elem)
+	case segProbation:
+		// promote to the protected segment
+		p.unlink(entry)
+		p.pushFront(p.protected, segProtected, entry)
+		for p.protected.Len() > p.protectedCap {
+			demoted := p.protected.Back().Value.(*listEntry)
+			p.unlink(demoted)
+			p.pushFront(p.probation, segProbation, demoted)
+		}
+	}
+}
+
+func (p *tinyLFUPolicy) remove(entry *listEntry) {
+	if entry == p.candidate {
+		p.candidate = nil
+	}
+	p.unlink(entry)
+}
+
+func (p *tinyLFUPolicy) victim(added *listEntry) *listEntry {
+	candidate := p.candidate
+	p.candidate = nil
+
+	victim := backExcept(p.probation, added)
+	if victim == nil {
+		victim = backExcept(p.protected, added)
+	}
+	if victim == nil {
+		victim = backExcept(p.window, added)
+	}
+
+	// the admission filter: the candidate wins only if it is more frequent
+	if candidate != nil && candidate != added && victim != nil && candidate != victim &&
+		p.sketch.estimate(candidate.key) <= p.sketch.estimate(victim.key) {
+		return candidate
+	}
+	return victim
+}
+
+func (p *tinyLFUPolicy) entries() []*listEntry {
+	entries := appendBackward(nil, p.probation)
+	entries = appendBackward(entries, p.window)
+	return appendBackward(entries, p.protected)
+}
+
+func (p *tinyLFUPolicy) pushFront(lst *list.List, seg segment, entry *listEntry) {
+	entry.seg = seg
+	entry.elem = lst.PushFront(entry)
+}
+
+func (p *tinyLFUPolicy) unlink(entry *listEntry) {
+	switch entry.seg {
+	case segWindow:
+		p.window.Remove(entry.elem)
+	case segProbation:
+		p.probation.Remove(entry.elem)
+	case segProtected:
+		p.protected.Remove(entry.elem)
+	}
+	entry.seg = segNone
+}
+
+const (
+	sketchDepth   = 4
+	sketchMaxFreq = 15
+)
+
+// countMinSketch estimates the access frequency of the keys, all the
+// counters are halved periodically so that the old keys fade out
+type countMinSketch struct {
+	seed      maphash.Seed
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := 16
+	for width < capacity {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		seed:    maphash.MakeSeed(),
+		mask:    uint64(width - 1),
+		resetAt: width * 10,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) index(h uint64, row int) uint64 {
+	// double hashing to get the index of each row
+	return (h + uint64(row)*(h>>32|1)) & s.mask
+}
+
+func (s *countMinSketch) increment(key Key) {
+	h := maphash.Comparable(s.seed, key)
+	for i := range s.rows {
+		if idx := s.index(h, i); s.rows[i][idx] < sketchMaxFreq {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(key Key) uint8 {
+	h := maphash.Comparable(s.seed, key)
+	freq := uint8(sketchMaxFreq)
+	for i := range s.rows {
+		freq = min(freq, s.rows[i][s.index(h, i)])
+	}
+	return freq
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
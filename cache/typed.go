@@ -0,0 +1,133 @@
+package cache
+
+import "time"
+
+// Typed is a type-safe wrapper of Cache, it shares the same lru & ttl engine
+// with the interface{} based cache, so both of them behave the same way
+type Typed[K comparable, V any] struct {
+	c Cache
+}
+
+// NewTyped will create a default configured typed cache
+func NewTyped[K comparable, V any]() *Typed[K, V] {
+	return &Typed[K, V]{c: NewCache()}
+}
+
+// NewTypedWithConfig will create a typed cache with the configs
+func NewTypedWithConfig[K comparable, V any](config Config) *Typed[K, V] {
+	return &Typed[K, V]{c: NewCacheWithConfig(config)}
+}
+
+// Put a value with the default cache time
+func (t *Typed[K, V]) Put(key K, value V) {
+	t.c.Put(key, value)
+}
+
+// PutWithTimeout put a value which will be expired after d
+func (t *Typed[K, V]) PutWithTimeout(key K, value V, d time.Duration) {
+	t.c.PutWithTimeout(key, value, d)
+}
+
+// PutWithTags put a value with the tags, which will be expired after d
+func (t *Typed[K, V]) PutWithTags(key K, value V, d time.Duration, tags ...string) {
+	t.c.PutWithTags(key, value, d, tags...)
+}
+
+// InvalidateTag removes all the keys with the tag
+func (t *Typed[K, V]) InvalidateTag(tag string) int {
+	return t.c.InvalidateTag(tag)
+}
+
+// Get the cached value of the key
+func (t *Typed[K, V]) Get(key K) (V, bool) {
+	return t.value(t.c.Get(key))
+}
+
+// Del the key and return the deleted value, or a zero value if not exists
+func (t *Typed[K, V]) Del(key K) V {
+	v, _ := t.value(t.c.Del(key), true)
+	return v
+}
+
+// GetMulti returns the cached values of the keys
+func (t *Typed[K, V]) GetMulti(keys []K) map[K]V {
+	return t.values(t.c.GetMulti(t.keys(keys)))
+}
+
+// PutMulti puts the values with the default cache time
+func (t *Typed[K, V]) PutMulti(values map[K]V) {
+	kvs := make(map[Key]Value, len(values))
+	for key, value := range values {
+		kvs[key] = value
+	}
+	t.c.PutMulti(kvs)
+}
+
+// DelMulti deletes the keys and returns the deleted values
+func (t *Typed[K, V]) DelMulti(keys []K) map[K]V {
+	return t.values(t.c.DelMulti(t.keys(keys)))
+}
+
+// Peek reads the value without promoting or extending it
+func (t *Typed[K, V]) Peek(key K) (V, bool) {
+	return t.value(t.c.Peek(key))
+}
+
+// Keys returns the unexpired keys
+func (t *Typed[K, V]) Keys() []K {
+	keys := t.c.Keys()
+	tkeys := make([]K, 0, len(keys))
+	for _, key := range keys {
+		tkeys = append(tkeys, key.(K))
+	}
+	return tkeys
+}
+
+// Range calls f for the unexpired entries until f returns false
+func (t *Typed[K, V]) Range(f func(key K, value V) bool) {
+	t.c.Range(func(key Key, value Value) bool {
+		v, _ := t.value(value, true)
+		return f(key.(K), v)
+	})
+}
+
+// Len of the cached keys
+func (t *Typed[K, V]) Len() int {
+	return t.c.Len()
+}
+
+// Stats of the cache
+func (t *Typed[K, V]) Stats() Stats {
+	return t.c.Stats()
+}
+
+// Close the cache
+func (t *Typed[K, V]) Close() {
+	t.c.Close()
+}
+
+func (t *Typed[K, V]) value(v Value, ok bool) (V, bool) {
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	// v may be nil if V is an interface or pointer type
+	tv, _ := v.(V)
+	return tv, true
+}
+
+func (t *Typed[K, V]) keys(keys []K) []Key {
+	ikeys := make([]Key, 0, len(keys))
+	for _, key := range keys {
+		ikeys = append(ikeys, key)
+	}
+	return ikeys
+}
+
+func (t *Typed[K, V]) values(values map[Key]Value) map[K]V {
+	tvalues := make(map[K]V, len(values))
+	for key, value := range values {
+		tvalues[key.(K)], _ = t.value(value, true)
+	}
+	return tvalues
+}
@@ -0,0 +1,70 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/leopoldxx/go-utils/cache"
+)
+
+func TestTypedCache(t *testing.T) {
+	evicted := map[string]int{}
+	cb := func(key Key, value Value) {
+		evicted[key.(string)] = value.(int)
+	}
+
+	cache := NewTypedWithConfig[string, int](Config{MaxLen: 2, Callback: cb})
+	defer cache.Close()
+
+	cache.Put("one", 1)
+	cache.Put("two", 2)
+	if v, ok := cache.Get("one"); !ok || v != 1 {
+		t.Fatalf("get one failed, expect 1, got %v, %v", v, ok)
+	}
+
+	// two is the oldest one now
+	cache.Put("three", 3)
+	if _, ok := cache.Get("two"); ok {
+		t.Fatalf("key two should be evicted")
+	}
+	if evicted["two"] != 2 {
+		t.Fatalf("callback of key two failed, got %v", evicted)
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("len failed, expect 2, got %d", cache.Len())
+	}
+
+	if v := cache.Del("three"); v != 3 {
+		t.Fatalf("del three failed, expect 3, got %v", v)
+	}
+	if v := cache.Del("three"); v != 0 {
+		t.Fatalf("del not exist key failed, expect zero value, got %v", v)
+	}
+	if v, ok := cache.Get("three"); ok || v != 0 {
+		t.Fatalf("get not exist key failed, got %v, %v", v, ok)
+	}
+}
+
+func TestTypedCacheNilValue(t *testing.T) {
+	cache := NewTyped[int, error]()
+	defer cache.Close()
+
+	cache.Put(1, nil)
+	if v, ok := cache.Get(1); !ok || v != nil {
+		t.Fatalf("get nil value failed, got %v, %v", v, ok)
+	}
+}
+
+func TestTypedCacheTime(t *testing.T) {
+	cache := NewTypedWithConfig[string, string](Config{MaxLen: 2, CacheTime: time.Second})
+	defer cache.Close()
+
+	cache.PutWithTimeout("key", "value", time.Second)
+	if v, ok := cache.Get("key"); !ok || v != "value" {
+		t.Fatalf("get key failed, got %v, %v", v, ok)
+	}
+	time.Sleep(time.Second + 100*time.Millisecond)
+	if _, ok := cache.Get("key"); ok {
+		t.Fatalf("key should be expired")
+	}
+}
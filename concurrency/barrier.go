@@ -1,35 +1,221 @@
 package concurrency
 
-// Barrier for limited go-routines
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrInvalidPermits is returned if the permits to acquire are not positive
+// or larger than the capacity of the barrier
+var ErrInvalidPermits = errors.New("the permits are out of the capacity of the barrier")
+
+// Barrier for limited go-routines, it is a weighted semaphore with a
+// resizable capacity, the waiters are served in FIFO order
 type Barrier struct {
-	c chan struct{}
+	mu      sync.Mutex
+	size    int
+	used    int
+	waiters list.List
+}
+
+type waiter struct {
+	n     int
+	ready chan struct{}
+	// strict waiters are rejected by Resize if n is larger than the capacity,
+	// the others wait for the barrier to be resized again
+	strict bool
+	// err is set if the waiter is rejected by Resize
+	err error
 }
 
 // NewBarrier creates new object and inits it
 func NewBarrier(num int) *Barrier {
-	b := &Barrier{}
-	b.c = make(chan struct{}, num)
-	for i := 0; i < num; i++ {
-		b.c <- struct{}{}
-	}
-	return b
+	return &Barrier{size: num}
 }
 
-// Advance 1 step if there still is a unused go-routine
+// Advance 1 step if there still is a unused go-routine, it blocks even if
+// the barrier is resized to 0, until it is resized again
 func (b *Barrier) Advance() {
+	b.acquire(context.Background(), 1, false)
+}
+
+// AdvanceContext advances 1 step, or returns the error of ctx if it is done
+// before there is a unused go-routine
+func (b *Barrier) AdvanceContext(ctx context.Context) error {
+	return b.acquire(ctx, 1, false)
+}
+
+// TryAdvance advances 1 step without blocking, it returns false if there is
+// no unused go-routine
+func (b *Barrier) TryAdvance() bool {
+	return b.TryAcquire(1)
+}
+
+// Done means outside will release the go routine, unlike Release, it does
+// not panic if there is no acquired go-routine
+func (b *Barrier) Done() {
 	if b == nil {
 		return
 	}
-	<-b.c
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used = max(b.used-1, 0)
+	b.notify()
 }
 
-// Done means outside will release the go routine
-func (b *Barrier) Done() {
+// Acquire n permits, it blocks until they are available or ctx is done.
+// ErrInvalidPermits is returned if n is not positive or larger than the
+// capacity, or the barrier is shrunk below n while waiting
+func (b *Barrier) Acquire(ctx context.Context, n int) error {
+	return b.acquire(ctx, n, true)
+}
+
+func (b *Barrier) acquire(ctx context.Context, n int, strict bool) error {
 	if b == nil {
-		return
+		return nil
 	}
 	select {
-	case b.c <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
 	default:
 	}
+
+	b.mu.Lock()
+	if n <= 0 || (strict && n > b.size) {
+		b.mu.Unlock()
+		return ErrInvalidPermits
+	}
+	if b.size-b.used >= n && b.waiters.Len() == 0 {
+		b.used += n
+		b.mu.Unlock()
+		return nil
+	}
+	w := &waiter{n: n, ready: make(chan struct{}), strict: strict}
+	elem := b.waiters.PushBack(w)
+	b.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return w.err
+	case <-ctx.Done():
+		b.mu.Lock()
+		select {
+		case <-w.ready:
+			if w.err != nil {
+				b.mu.Unlock()
+				return w.err
+			}
+			// acquired after ctx is done, give the permits back
+			b.used -= n
+		default:
+			b.waiters.Remove(elem)
+		}
+		// the waiters behind it may be able to go now
+		b.notify()
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// TryAcquire n permits without blocking, it returns false if they are not
+// available, or n is not positive or larger than the capacity
+func (b *Barrier) TryAcquire(n int) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > 0 && b.size-b.used >= n && b.waiters.Len() == 0 {
+		b.used += n
+		return true
+	}
+	return false
+}
+
+// Release n permits, it panics if n is not positive or more than the
+// acquired permits
+func (b *Barrier) Release(n int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n <= 0 || n > b.used {
+		panic("concurrency: barrier released more permits than held")
+	}
+	b.used -= n
+	b.notify()
+}
+
+// Resize the capacity of the barrier, if it is shrunk below the permits in
+// use, the new acquirers wait until enough permits are released. The
+// waiters of Acquire for more permits than the new capacity get
+// ErrInvalidPermits, the waiters of Advance keep waiting
+func (b *Barrier) Resize(num int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.size = num
+	for elem := b.waiters.Front(); elem != nil; {
+		next := elem.Next()
+		if w := elem.Value.(*waiter); w.strict && w.n > num {
+			w.err = ErrInvalidPermits
+			b.waiters.Remove(elem)
+			close(w.ready)
+		}
+		elem = next
+	}
+	b.notify()
+}
+
+// Cap returns the capacity of the barrier
+func (b *Barrier) Cap() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// InUse returns the number of the acquired permits
+func (b *Barrier) InUse() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// Available returns the number of the permits which can be acquired now
+func (b *Barrier) Available() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return max(b.size-b.used, 0)
+}
+
+// notify the waiters in FIFO order, it stops at the first one which can not
+// go, so that the large acquirers are not starved
+func (b *Barrier) notify() {
+	for {
+		elem := b.waiters.Front()
+		if elem == nil {
+			return
+		}
+		w := elem.Value.(*waiter)
+		if b.size-b.used < w.n {
+			return
+		}
+		b.used += w.n
+		b.waiters.Remove(elem)
+		close(w.ready)
+	}
 }
@@ -1,8 +1,10 @@
 package concurrency
 
 import (
+	"context"
 	"log"
 	"sync"
+	"testing"
 	"time"
 )
 
@@ -23,7 +25,177 @@ func ExampleBarrier() {
 			log.Printf("done %d", i)
 		}(i)
 	}
-	wg.Done()
+	wg.Wait()
 
 	// Output:
 }
+
+func TestBarrierContext(t *testing.T) {
+	b := NewBarrier(2)
+	if !b.TryAdvance() || !b.TryAdvance() || b.TryAdvance() {
+		t.Fatal("try advance failed")
+	}
+	if b.InUse() != 2 || b.Available() != 0 || b.Cap() != 2 {
+		t.Fatalf("introspection failed, got %d, %d, %d", b.InUse(), b.Available(), b.Cap())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.AdvanceContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("advance should be timeout, got %v", err)
+	}
+	if b.InUse() != 2 {
+		t.Fatalf("in use after timeout failed, got %d", b.InUse())
+	}
+
+	b.Done()
+	if err := b.AdvanceContext(context.Background()); err != nil {
+		t.Fatal("advance failed:", err)
+	}
+
+	b.Release(2)
+	if b.InUse() != 0 || b.Available() != 2 {
+		t.Fatalf("release failed, got %d, %d", b.InUse(), b.Available())
+	}
+}
+
+func TestBarrierInvalidPermits(t *testing.T) {
+	b := NewBarrier(2)
+	for _, n := range []int{0, -1, 3} {
+		if err := b.Acquire(context.Background(), n); err != ErrInvalidPermits {
+			t.Fatalf("test key %d failed, expect %v, got %v", n, ErrInvalidPermits, err)
+		}
+		if b.TryAcquire(n) {
+			t.Fatalf("test key %d failed, try acquire should be rejected", n)
+		}
+	}
+
+	// the waiter is rejected if the barrier is shrunk below its permits
+	b.Advance()
+	errCh := make(chan error)
+	go func() {
+		errCh <- b.Acquire(context.Background(), 2)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	b.Resize(1)
+	if err := <-errCh; err != ErrInvalidPermits || b.InUse() != 1 {
+		t.Fatalf("acquire after shrinking failed, got %v, in use %d", err, b.InUse())
+	}
+
+	for _, n := range []int{0, 2} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("test key %d failed, release should panic", n)
+				}
+			}()
+			b.Release(n)
+		}()
+	}
+}
+
+func TestBarrierWeighted(t *testing.T) {
+	b := NewBarrier(5)
+	if err := b.Acquire(context.Background(), 3); err != nil {
+		t.Fatal("acquire 3 failed:", err)
+	}
+
+	// the large acquirer is not starved by the small ones behind it
+	acquired := make(chan int, 2)
+	go func() {
+		b.Acquire(context.Background(), 4)
+		acquired <- 4
+	}()
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		b.Acquire(context.Background(), 1)
+		acquired <- 1
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if b.TryAcquire(1) {
+		t.Fatal("try acquire should not jump the queue")
+	}
+	select {
+	case n := <-acquired:
+		t.Fatalf("acquire %d should not jump the queue", n)
+	default:
+	}
+
+	// both of them can go after releasing
+	b.Release(3)
+	if n1, n2 := <-acquired, <-acquired; n1+n2 != 5 || b.InUse() != 5 {
+		t.Fatalf("acquire after releasing failed, got %d, %d, in use %d", n1, n2, b.InUse())
+	}
+}
+
+func TestBarrierResize(t *testing.T) {
+	b := NewBarrier(1)
+	b.Advance()
+
+	done := make(chan struct{})
+	go func() {
+		b.Advance()
+		b.Advance()
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	b.Resize(3)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("advance after resizing failed")
+	}
+
+	// shrink below the permits in use
+	b.Resize(1)
+	if b.InUse() != 3 || b.Available() != 0 || b.TryAdvance() {
+		t.Fatalf("shrink failed, got %d, %d", b.InUse(), b.Available())
+	}
+	b.Done()
+	b.Done()
+	if b.TryAdvance() {
+		t.Fatal("advance should be blocked until enough permits are released")
+	}
+	b.Done()
+	if !b.TryAdvance() {
+		t.Fatal("advance after releasing failed")
+	}
+
+	var nb *Barrier
+	nb.Advance()
+	nb.Done()
+}
+
+func TestBarrierPause(t *testing.T) {
+	b := NewBarrier(1)
+	b.Advance()
+
+	done := make(chan struct{})
+	go func() {
+		b.Advance()
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// the advance waits for the barrier to be resized again
+	b.Resize(0)
+	b.Done()
+	select {
+	case <-done:
+		t.Fatalf("advance should be paused, got in use %d, cap %d", b.InUse(), b.Cap())
+	case <-time.After(50 * time.Millisecond):
+	}
+	b.Resize(1)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("advance after resizing failed")
+	}
+
+	// over done is ignored
+	b.Done()
+	b.Done()
+	if b.InUse() != 0 || b.Available() != 1 {
+		t.Fatalf("over done failed, got %d, %d", b.InUse(), b.Available())
+	}
+}
@@ -0,0 +1,145 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/leopoldxx/go-utils/trace"
+)
+
+// MultiError holds all the errors of the group
+type MultiError []error
+
+func (me MultiError) Error() string {
+	errStr := make([]string, 0, len(me))
+	for _, err := range me {
+		errStr = append(errStr, err.Error())
+	}
+	return strings.Join(errStr, ";")
+}
+
+// Unwrap is for errors.Is & errors.As
+func (me MultiError) Unwrap() []error {
+	return me
+}
+
+// PanicError is the error recovered from the panic of the func
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v, detail: %s", pe.Value, pe.Stack)
+}
+
+type groupOptions struct {
+	limit   int
+	collect bool
+}
+
+// GroupOption for the group
+type GroupOption func(opts *groupOptions)
+
+// WithLimit limits the number of the funcs running at the same time
+func WithLimit(n int) GroupOption {
+	return func(opts *groupOptions) {
+		opts.limit = n
+	}
+}
+
+// CollectErrors runs all the funcs without canceling the context on error,
+// and Wait returns all the errors as a MultiError
+func CollectErrors() GroupOption {
+	return func(opts *groupOptions) {
+		opts.collect = true
+	}
+}
+
+// Group runs the funcs in go-routines and waits for them. By default the
+// shared context is canceled on the first error, and Wait returns it
+type Group struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	barrier *Barrier
+	collect bool
+	wg      sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// NewGroup creates a group and the shared context derived from ctx
+func NewGroup(ctx context.Context, opts ...GroupOption) (*Group, context.Context) {
+	var options groupOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	g := &Group{collect: options.collect}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	if options.limit > 0 {
+		g.barrier = NewBarrier(options.limit)
+	}
+	return g, g.ctx
+}
+
+// Go runs fn in a go-routine, it blocks if the limit is reached. If the shared
+// context is done, fn is not run and the error of the context is recorded
+func (g *Group) Go(fn func(ctx context.Context) error) {
+	if err := g.barrier.AdvanceContext(g.ctx); err != nil {
+		g.fail(err)
+		return
+	}
+	// the context may be canceled while the barrier is released
+	if err := g.ctx.Err(); err != nil {
+		g.barrier.Done()
+		g.fail(err)
+		return
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.barrier.Done()
+		if err := g.run(fn); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+func (g *Group) run(fn func(ctx context.Context) error) (err error) {
+	defer trace.HandleCrash(func(r interface{}) {
+		err = &PanicError{Value: r, Stack: trace.Stacks(false)}
+	})
+	return fn(g.ctx)
+}
+
+func (g *Group) fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.collect {
+		g.errs = append(g.errs, err)
+		return
+	}
+	if len(g.errs) == 0 {
+		g.errs = append(g.errs, err)
+		g.cancel()
+	}
+}
+
+// Wait for all the funcs, it returns the first error, or the MultiError of
+// all the errors if CollectErrors is set
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.errs) == 0 {
+		return nil
+	}
+	if g.collect {
+		return MultiError(append([]error(nil), g.errs...))
+	}
+	return g.errs[0]
+}
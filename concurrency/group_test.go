@@ -0,0 +1,84 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	g, ctx := NewGroup(context.Background(), WithLimit(2))
+	var running, peak int32
+	for i := 0; i < 10; i++ {
+		g.Go(func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal("wait failed:", err)
+	}
+	if peak > 2 {
+		t.Fatalf("limit failed, expect 2, got %d", peak)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("the context should be canceled after wait")
+	}
+}
+
+func TestGroupFirstError(t *testing.T) {
+	errFirst := errors.New("first error")
+	g, _ := NewGroup(context.Background(), WithLimit(1))
+	var canceled int32
+	g.Go(func(ctx context.Context) error {
+		return errFirst
+	})
+	for i := 0; i < 5; i++ {
+		g.Go(func(ctx context.Context) error {
+			atomic.AddInt32(&canceled, 1)
+			return errors.New("should not be run")
+		})
+	}
+	if err := g.Wait(); err != errFirst {
+		t.Fatalf("wait failed, expect %v, got %v", errFirst, err)
+	}
+	if canceled != 0 {
+		t.Fatalf("the funcs after the error should not be run, got %d", canceled)
+	}
+}
+
+func TestGroupCollectErrors(t *testing.T) {
+	g, _ := NewGroup(context.Background(), CollectErrors())
+	for i := 0; i < 3; i++ {
+		i := i
+		g.Go(func(ctx context.Context) error {
+			if i == 2 {
+				panic("oops!")
+			}
+			return fmt.Errorf("error %d", i)
+		})
+	}
+	g.Go(func(ctx context.Context) error { return nil })
+
+	err := g.Wait()
+	var me MultiError
+	if !errors.As(err, &me) || len(me) != 3 {
+		t.Fatalf("collect errors failed, got %v", err)
+	}
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "oops!" || !strings.Contains(string(pe.Stack), "group_test.go") {
+		t.Fatalf("panic error failed, got %v", pe)
+	}
+}
@@ -0,0 +1,75 @@
+package concurrency_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/leopoldxx/go-utils/cache"
+	"github.com/leopoldxx/go-utils/cache/counter"
+	. "github.com/leopoldxx/go-utils/concurrency"
+)
+
+func TestKeyedLimiter(t *testing.T) {
+	clock := counter.NewFakeClock(time.Unix(1000, 0))
+	store := cache.NewTypedWithConfig[string, RateLimiter](cache.Config{MaxLen: 2})
+	kl := NewKeyedLimiter(store, time.Minute, func(key string) RateLimiter {
+		return NewTokenBucket(1, 1, WithClock(clock))
+	})
+	defer kl.Close()
+
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("user%d", i)
+		if !kl.Allow(key) || kl.Allow(key) {
+			t.Fatalf("test key %s failed", key)
+		}
+	}
+	if kl.Len() != 2 {
+		t.Fatalf("keys should be bounded, expect 2, got %d", kl.Len())
+	}
+	// the limiter of user0 is dropped, user2 is still limited
+	if !kl.Allow("user0") || kl.Allow("user2") {
+		t.Fatal("lru of the limiters failed")
+	}
+	if r := kl.Reserve("user2"); r.Delay() != time.Second {
+		t.Fatalf("reserve failed, got %v", r.Delay())
+	}
+}
+
+func TestKeyedLimiterConcurrent(t *testing.T) {
+	store := cache.NewTypedWithConfig[string, RateLimiter](cache.Config{MaxLen: 100})
+	kl := NewKeyedLimiter(store, time.Minute, func(key string) RateLimiter {
+		return NewTokenBucket(1, 10, WithClock(counter.NewFakeClock(time.Unix(1000, 0))))
+	})
+	defer kl.Close()
+
+	// one limiter is created for every key, so only the burst is allowed
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed = map[string]int{}
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if kl.Allow(key) {
+					mu.Lock()
+					allowed[key]++
+					mu.Unlock()
+				}
+			}
+		}(fmt.Sprintf("user%d", i%10))
+	}
+	wg.Wait()
+	for key, n := range allowed {
+		if n != 10 {
+			t.Fatalf("test key %s failed, expect 10, got %d", key, n)
+		}
+	}
+	if len(allowed) != 10 {
+		t.Fatalf("keys failed, expect 10, got %d", len(allowed))
+	}
+}
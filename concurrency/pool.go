@@ -0,0 +1,172 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/leopoldxx/go-utils/trace"
+)
+
+// errors of the pool
+var (
+	ErrPoolStopped = errors.New("the pool is stopped")
+	ErrPoolFull    = errors.New("the queue of the pool is full")
+)
+
+// Task is the work submitted into the pool
+type Task func(ctx context.Context)
+
+type poolTask struct {
+	ctx context.Context
+	fn  Task
+}
+
+// Pool runs the submitted tasks with a fixed number of workers, the tasks
+// wait in a bounded queue until there is an idle worker
+type Pool struct {
+	tasks    chan poolTask
+	ctx      context.Context
+	cancel   context.CancelFunc
+	workers  sync.WaitGroup
+	running  int32
+	stopOnce sync.Once
+
+	mu         sync.RWMutex
+	stopped    bool
+	stopping   chan struct{}
+	submitting sync.WaitGroup
+}
+
+// NewPool creates a pool and starts the workers
+func NewPool(workers, queueSize int) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		tasks:    make(chan poolTask, queueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		stopping: make(chan struct{}),
+	}
+	for i := 0; i < max(workers, 1); i++ {
+		p.workers.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.workers.Done()
+	for task := range p.tasks {
+		// the queued tasks are dropped if the pool is canceled
+		if p.ctx.Err() != nil {
+			continue
+		}
+		p.run(task)
+	}
+}
+
+func (p *Pool) run(task poolTask) {
+	atomic.AddInt32(&p.running, 1)
+	defer atomic.AddInt32(&p.running, -1)
+	defer trace.HandleCrash(func(r interface{}) {
+		trace.LogCrashStack(task.ctx, r)
+	})
+	task.fn(task.ctx)
+}
+
+// newTask binds the task with a context carrying the trace of the submitter,
+// the context is not canceled with the submitter's one, but when the pool is
+// stopped without draining
+func (p *Pool) newTask(ctx context.Context, fn Task) poolTask {
+	return poolTask{
+		ctx: trace.WithTraceForContext2(p.ctx, trace.GetTraceFromContext(ctx)),
+		fn:  fn,
+	}
+}
+
+func (p *Pool) enter() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped {
+		return false
+	}
+	p.submitting.Add(1)
+	return true
+}
+
+// Submit the task, it blocks if the queue is full until the task is queued,
+// ctx is done or the pool is stopped
+func (p *Pool) Submit(ctx context.Context, fn Task) error {
+	if !p.enter() {
+		return ErrPoolStopped
+	}
+	defer p.submitting.Done()
+
+	select {
+	case p.tasks <- p.newTask(ctx, fn):
+		return nil
+	case <-p.stopping:
+		return ErrPoolStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TrySubmit the task without blocking, ErrPoolFull is returned if the queue
+// is full
+func (p *Pool) TrySubmit(ctx context.Context, fn Task) error {
+	if !p.enter() {
+		return ErrPoolStopped
+	}
+	defer p.submitting.Done()
+
+	select {
+	case p.tasks <- p.newTask(ctx, fn):
+		return nil
+	default:
+		return ErrPoolFull
+	}
+}
+
+// Pending returns the number of the queued tasks
+func (p *Pool) Pending() int {
+	return len(p.tasks)
+}
+
+// Running returns the number of the running tasks
+func (p *Pool) Running() int {
+	return int(atomic.LoadInt32(&p.running))
+}
+
+// Stop accepting the tasks and wait for the submitted ones to be done.
+// If ctx is done before that, the contexts of the running tasks are canceled,
+// the queued ones are dropped, and the error of ctx is returned after the
+// workers exit. Use a canceled ctx to stop the pool at once
+func (p *Pool) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.stopped = true
+		close(p.stopping)
+		p.mu.Unlock()
+		// the blocked submitters return at once after stopping is closed
+		p.submitting.Wait()
+		close(p.tasks)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,120 @@
+package concurrency
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/leopoldxx/go-utils/trace"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool(2, 10)
+
+	ctx := trace.WithTraceForContext(context.Background(), "test", "test-trace-id")
+	ids := make(chan string, 1)
+	if err := p.Submit(ctx, func(ctx context.Context) {
+		ids <- trace.GetTraceFromContext(ctx).ID()
+	}); err != nil {
+		t.Fatal("submit failed:", err)
+	}
+	if id := <-ids; id != "test-trace-id" {
+		t.Fatalf("trace of the task failed, expect test-trace-id, got %s", id)
+	}
+
+	// the worker survives the panic
+	var done int32
+	p.Submit(ctx, func(ctx context.Context) { panic("oops!") })
+	for i := 0; i < 10; i++ {
+		p.Submit(ctx, func(ctx context.Context) {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&done, 1)
+		})
+	}
+
+	// the submitted tasks are drained
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatal("stop failed:", err)
+	}
+	if n := atomic.LoadInt32(&done); n != 10 {
+		t.Fatalf("drained tasks failed, expect 10, got %d", n)
+	}
+	if err := p.Submit(ctx, func(ctx context.Context) {}); err != ErrPoolStopped {
+		t.Fatalf("submit after stop failed, got %v", err)
+	}
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatal("stop twice failed:", err)
+	}
+}
+
+func TestPoolBounded(t *testing.T) {
+	p := NewPool(1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p.Submit(context.Background(), func(ctx context.Context) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	if err := p.TrySubmit(context.Background(), func(ctx context.Context) {}); err != nil {
+		t.Fatal("try submit into the queue failed:", err)
+	}
+	if err := p.TrySubmit(context.Background(), func(ctx context.Context) {}); err != ErrPoolFull {
+		t.Fatalf("try submit into the full queue failed, got %v", err)
+	}
+	if p.Running() != 1 || p.Pending() != 1 {
+		t.Fatalf("introspection failed, got %d, %d", p.Running(), p.Pending())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Submit(ctx, func(ctx context.Context) {}); err != context.DeadlineExceeded {
+		t.Fatalf("blocked submit should be timeout, got %v", err)
+	}
+
+	// the blocked submitter returns when the pool is stopped
+	submitted := make(chan error)
+	go func() {
+		submitted <- p.Submit(context.Background(), func(ctx context.Context) {})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	stopped := make(chan error)
+	go func() {
+		stopped <- p.Stop(context.Background())
+	}()
+	if err := <-submitted; err != ErrPoolStopped {
+		t.Fatalf("blocked submit after stop failed, got %v", err)
+	}
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatal("stop failed:", err)
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	p := NewPool(1, 10)
+	var canceled, dropped int32
+	started := make(chan struct{})
+	p.Submit(context.Background(), func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		atomic.StoreInt32(&canceled, 1)
+	})
+	for i := 0; i < 5; i++ {
+		p.Submit(context.Background(), func(ctx context.Context) {
+			atomic.AddInt32(&dropped, 1)
+		})
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.Stop(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("stop should be timeout, got %v", err)
+	}
+	if atomic.LoadInt32(&canceled) != 1 || atomic.LoadInt32(&dropped) != 0 {
+		t.Fatalf("cancel failed, got %d, %d", canceled, dropped)
+	}
+}
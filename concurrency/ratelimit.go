@@ -0,0 +1,357 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/leopoldxx/go-utils/cache/counter"
+)
+
+// ErrRateLimited is returned by Wait if the wait exceeds the deadline of ctx
+var ErrRateLimited = errors.New("the rate limit wait exceeds the deadline of the context")
+
+const infiniteWait = time.Duration(math.MaxInt64)
+
+// RateLimiter limits the rate of the events
+type RateLimiter interface {
+	// Allow reports whether an event may happen now
+	Allow() bool
+	// Wait blocks until an event may happen or ctx is done
+	Wait(ctx context.Context) error
+	// Reserve an event, the caller should wait for the Delay of the
+	// Reservation before acting, or Cancel it
+	Reserve() *Reservation
+}
+
+// Reservation of an event of the RateLimiter
+type Reservation struct {
+	l  *limiter
+	ok bool
+	at time.Time
+}
+
+// OK reports whether the event can happen, it is false if the limiter can
+// never allow the event, such as the zero rate
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long to wait before acting
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return infiniteWait
+	}
+	return max(r.at.Sub(r.l.clock.Now()), 0)
+}
+
+// Cancel the reservation, the event is given back if it is not due
+func (r *Reservation) Cancel() {
+	if r.ok {
+		r.l.cancel(r.at)
+	}
+}
+
+type limiterOptions struct {
+	clock counter.Clock
+}
+
+// LimiterOption for the rate limiters
+type LimiterOption func(opts *limiterOptions)
+
+// WithClock sets the clock of the rate limiter, counter.FakeClock can be used
+// in tests
+func WithClock(clock counter.Clock) LimiterOption {
+	return func(opts *limiterOptions) {
+		opts.clock = clock
+	}
+}
+
+// algorithm of the rate limiter, it is called with the lock held
+type algorithm interface {
+	// reserve an event at now or later, but no later than now+maxWait
+	reserve(now time.Time, maxWait time.Duration) (time.Time, bool)
+	// cancel the reserved event which is not due
+	cancel(now, at time.Time)
+}
+
+type limiter struct {
+	sync.Mutex
+	clock counter.Clock
+	algo  algorithm
+}
+
+func newLimiter(algo algorithm, opts []LimiterOption) *limiter {
+	options := limiterOptions{clock: counter.SystemClock}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &limiter{clock: options.clock, algo: algo}
+}
+
+func (l *limiter) reserve(maxWait time.Duration) (time.Time, time.Time, bool) {
+	l.Lock()
+	defer l.Unlock()
+	now := l.clock.Now()
+	at, ok := l.algo.reserve(now, maxWait)
+	return now, at, ok
+}
+
+func (l *limiter) cancel(at time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	if now := l.clock.Now(); at.After(now) {
+		l.algo.cancel(now, at)
+	}
+}
+
+func (l *limiter) Allow() bool {
+	_, _, ok := l.reserve(0)
+	return ok
+}
+
+func (l *limiter) Reserve() *Reservation {
+	_, at, ok := l.reserve(infiniteWait)
+	return &Reservation{l: l, ok: ok, at: at}
+}
+
+func (l *limiter) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	maxWait := infiniteWait
+	if deadline, ok := ctx.Deadline(); ok {
+		maxWait = time.Until(deadline)
+	}
+	now, at, ok := l.reserve(maxWait)
+	if !ok {
+		return ErrRateLimited
+	}
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-l.clock.After(delay):
+		return nil
+	case <-ctx.Done():
+		l.cancel(at)
+		return ctx.Err()
+	}
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a token bucket limiter, the bucket holds at most
+// burst tokens and is refilled at rate tokens per second
+func NewTokenBucket(rate float64, burst int, opts ...LimiterOption) RateLimiter {
+	l := newLimiter(nil, opts)
+	l.algo = &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: l.clock.Now()}
+	return l
+}
+
+func (tb *tokenBucket) advance(now time.Time) {
+	if now.After(tb.last) {
+		tb.tokens = min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+		tb.last = now
+	}
+}
+
+func (tb *tokenBucket) reserve(now time.Time, maxWait time.Duration) (time.Time, bool) {
+	tb.advance(now)
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return now, true
+	}
+	if tb.rate <= 0 {
+		tb.tokens++
+		return time.Time{}, false
+	}
+	wait := time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+	if wait > maxWait {
+		tb.tokens++
+		return time.Time{}, false
+	}
+	return now.Add(wait), true
+}
+
+func (tb *tokenBucket) cancel(now, at time.Time) {
+	tb.advance(now)
+	tb.tokens = min(tb.burst, tb.tokens+1)
+}
+
+type gcra struct {
+	interval  time.Duration
+	tolerance time.Duration
+	// tat is the theoretical arrival time of the next event
+	tat time.Time
+}
+
+// NewGCRA creates a generic cell rate algorithm limiter, the events are
+// spaced at rate per second, with bursts of at most burst events
+func NewGCRA(rate float64, burst int, opts ...LimiterOption) RateLimiter {
+	interval := infiniteWait
+	if rate > 0 {
+		interval = time.Duration(float64(time.Second) / rate)
+	}
+	return newLimiter(&gcra{interval: interval, tolerance: interval * time.Duration(max(burst, 1))}, opts)
+}
+
+func (g *gcra) reserve(now time.Time, maxWait time.Duration) (time.Time, bool) {
+	if g.interval == infiniteWait {
+		return time.Time{}, false
+	}
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(g.interval)
+	at := newTat.Add(-g.tolerance)
+	if at.Before(now) {
+		at = now
+	}
+	if at.Sub(now) > maxWait {
+		return time.Time{}, false
+	}
+	g.tat = newTat
+	return at, true
+}
+
+func (g *gcra) cancel(now, at time.Time) {
+	g.tat = g.tat.Add(-g.interval)
+}
+
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+	// log of the event times in ascending order, it may have the reserved
+	// events in the future
+	log []time.Time
+}
+
+// NewSlidingWindow creates a sliding window log limiter, it allows at most
+// limit events in any window
+func NewSlidingWindow(limit int, window time.Duration, opts ...LimiterOption) RateLimiter {
+	return newLimiter(&slidingWindow{limit: limit, window: window}, opts)
+}
+
+func (sw *slidingWindow) reserve(now time.Time, maxWait time.Duration) (time.Time, bool) {
+	if sw.limit <= 0 {
+		return time.Time{}, false
+	}
+	// drop the events out of the window
+	expired := sort.Search(len(sw.log), func(i int) bool {
+		return sw.log[i].Add(sw.window).After(now)
+	})
+	sw.log = sw.log[expired:]
+
+	at := now
+	if n := len(sw.log); n >= sw.limit {
+		if due := sw.log[n-sw.limit].Add(sw.window); due.After(now) {
+			at = due
+		}
+	}
+	if at.Sub(now) > maxWait {
+		return time.Time{}, false
+	}
+	idx := sort.Search(len(sw.log), func(i int) bool { return sw.log[i].After(at) })
+	sw.log = append(sw.log, time.Time{})
+	copy(sw.log[idx+1:], sw.log[idx:])
+	sw.log[idx] = at
+	return at, true
+}
+
+func (sw *slidingWindow) cancel(now, at time.Time) {
+	for idx := range sw.log {
+		if sw.log[idx].Equal(at) {
+			sw.log = append(sw.log[:idx], sw.log[idx+1:]...)
+			return
+		}
+	}
+}
+
+// LimiterStore holds the limiters of the keys, it should drop the limiters
+// which are not put again in the timeout, and bound the number of them, such
+// as cache.NewTypedWithConfig[string, RateLimiter]
+type LimiterStore interface {
+	Get(key string) (RateLimiter, bool)
+	PutWithTimeout(key string, l RateLimiter, d time.Duration)
+	Len() int
+	Close()
+}
+
+// the number of the locks of the keys
+const keyedLocks = 64
+
+// KeyedLimiter holds a limiter per key in the store, the limiters idle for
+// the idle time are dropped, so the idle time should be longer than the time
+// a limiter takes to be refilled
+type KeyedLimiter struct {
+	// the limiter of a key is created under the lock of the key, so the
+	// different keys do not wait for each other
+	seed       maphash.Seed
+	locks      [keyedLocks]sync.Mutex
+	limiters   LimiterStore
+	idle       time.Duration
+	newLimiter func(key string) RateLimiter
+}
+
+// NewKeyedLimiter creates a keyed limiter which holds the limiters in store
+func NewKeyedLimiter(store LimiterStore, idle time.Duration, newLimiter func(key string) RateLimiter) *KeyedLimiter {
+	return &KeyedLimiter{
+		seed:       maphash.MakeSeed(),
+		limiters:   store,
+		idle:       idle,
+		newLimiter: newLimiter,
+	}
+}
+
+// Get the limiter of the key, it is created if not exists
+func (kl *KeyedLimiter) Get(key string) RateLimiter {
+	mu := &kl.locks[maphash.String(kl.seed, key)%keyedLocks]
+	mu.Lock()
+	defer mu.Unlock()
+	l, ok := kl.limiters.Get(key)
+	if !ok {
+		l = kl.newLimiter(key)
+	}
+	// put it again to extend the idle time
+	kl.limiters.PutWithTimeout(key, l, kl.idle)
+	return l
+}
+
+// Allow reports whether an event of the key may happen now
+func (kl *KeyedLimiter) Allow(key string) bool {
+	return kl.Get(key).Allow()
+}
+
+// Wait blocks until an event of the key may happen or ctx is done
+func (kl *KeyedLimiter) Wait(ctx context.Context, key string) error {
+	return kl.Get(key).Wait(ctx)
+}
+
+// Reserve an event of the key
+func (kl *KeyedLimiter) Reserve(key string) *Reservation {
+	return kl.Get(key).Reserve()
+}
+
+// Len returns the number of the limiters
+func (kl *KeyedLimiter) Len() int {
+	return kl.limiters.Len()
+}
+
+// Close the keyed limiter
+func (kl *KeyedLimiter) Close() {
+	kl.limiters.Close()
+}
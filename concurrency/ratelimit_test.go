@@ -0,0 +1,140 @@
+package concurrency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/leopoldxx/go-utils/cache/counter"
+)
+
+type allowStep struct {
+	advance time.Duration
+	expect  []bool
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	// the burst of 3, and refilled one by one every 100ms
+	bucketSteps := []allowStep{
+		{0, []bool{true, true, true, false}},
+		{50 * time.Millisecond, []bool{false}},
+		{50 * time.Millisecond, []bool{true, false}},
+		{time.Second, []bool{true, true, true, false}},
+	}
+	testCases := []struct {
+		name  string
+		new   func(clock counter.Clock) RateLimiter
+		steps []allowStep
+	}{
+		{"token bucket", func(clock counter.Clock) RateLimiter { return NewTokenBucket(10, 3, WithClock(clock)) }, bucketSteps},
+		{"gcra", func(clock counter.Clock) RateLimiter { return NewGCRA(10, 3, WithClock(clock)) }, bucketSteps},
+		// the events are back only when they slide out of the window
+		{"sliding window", func(clock counter.Clock) RateLimiter {
+			return NewSlidingWindow(3, 300*time.Millisecond, WithClock(clock))
+		}, []allowStep{
+			{0, []bool{true, true}},
+			{100 * time.Millisecond, []bool{true, false}},
+			{150 * time.Millisecond, []bool{false}},
+			{50 * time.Millisecond, []bool{true, true, false}},
+			{100 * time.Millisecond, []bool{true, false}},
+		}},
+	}
+	for _, tc := range testCases {
+		clock := counter.NewFakeClock(time.Unix(1000, 0))
+		l := tc.new(clock)
+		for idx, step := range tc.steps {
+			clock.Advance(step.advance)
+			for i, expect := range step.expect {
+				if got := l.Allow(); got != expect {
+					t.Fatalf("test key %s step %d event %d failed, expect %v, got %v", tc.name, idx, i, expect, got)
+				}
+			}
+		}
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	for _, name := range []string{"token bucket", "gcra", "sliding window"} {
+		clock := counter.NewFakeClock(time.Unix(1000, 0))
+		var l RateLimiter
+		switch name {
+		case "token bucket":
+			l = NewTokenBucket(10, 1, WithClock(clock))
+		case "gcra":
+			l = NewGCRA(10, 1, WithClock(clock))
+		default:
+			l = NewSlidingWindow(1, 100*time.Millisecond, WithClock(clock))
+		}
+
+		expects := []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond}
+		var reservations []*Reservation
+		for i, expect := range expects {
+			r := l.Reserve()
+			if !r.OK() || r.Delay() != expect {
+				t.Fatalf("test key %s reservation %d failed, expect %v, got %v", name, i, expect, r.Delay())
+			}
+			reservations = append(reservations, r)
+		}
+
+		// the canceled one is given back
+		reservations[2].Cancel()
+		clock.Advance(100 * time.Millisecond)
+		if r := l.Reserve(); r.Delay() != 100*time.Millisecond {
+			t.Fatalf("test key %s reservation after cancel failed, got %v", name, r.Delay())
+		}
+	}
+
+	if r := NewTokenBucket(0, 0).Reserve(); r.OK() {
+		t.Fatal("the zero rate should never be reserved")
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	clock := counter.NewFakeClock(time.Unix(1000, 0))
+	l := NewGCRA(1, 1, WithClock(clock))
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal("wait failed:", err)
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- l.Wait(context.Background())
+	}()
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case err := <-waited:
+		t.Fatalf("wait should be blocked, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(500 * time.Millisecond)
+	if err := <-waited; err != nil {
+		t.Fatal("wait failed:", err)
+	}
+
+	// the canceled wait gives the event back
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		waited <- l.Wait(ctx)
+	}()
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-waited; err != context.Canceled {
+		t.Fatalf("wait should be canceled, got %v", err)
+	}
+	clock.Advance(time.Second)
+	if !l.Allow() {
+		t.Fatal("allow after the canceled wait failed")
+	}
+
+	// fail fast if the wait exceeds the deadline
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if err := l.Wait(ctx); err != ErrRateLimited {
+		t.Fatalf("wait should be rate limited, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package concurrency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/leopoldxx/go-utils/trace"
+)
+
+type flightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+	dups int
+}
+
+// Singleflight collapses the concurrent calls with the same key into one,
+// the zero value is ready to use
+type Singleflight struct {
+	// Timeout bounds the calls of DoContext if it is not zero, the callers
+	// without a deadline may wait for a hung call forever otherwise
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// join the in-flight call of the key, or start a new one
+func (sf *Singleflight) join(key string) (*flightCall, bool) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	if sf.calls == nil {
+		sf.calls = map[string]*flightCall{}
+	}
+	if c, ok := sf.calls[key]; ok {
+		c.dups++
+		return c, false
+	}
+	c := &flightCall{done: make(chan struct{})}
+	sf.calls[key] = c
+	return c, true
+}
+
+func (sf *Singleflight) call(c *flightCall, key string, fn func() (interface{}, error)) {
+	defer func() {
+		sf.mu.Lock()
+		if sf.calls[key] == c {
+			delete(sf.calls, key)
+		}
+		sf.mu.Unlock()
+		close(c.done)
+	}()
+	defer trace.HandleCrash(func(r interface{}) {
+		c.err = &PanicError{Value: r, Stack: trace.Stacks(false)}
+	})
+	c.val, c.err = fn()
+}
+
+func (sf *Singleflight) shared(c *flightCall) bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return c.dups > 0
+}
+
+// Do calls fn once for the concurrent calls with the same key, and all of
+// them get the same result. The shared flag reports whether the result is
+// given to more than one caller. The panic of fn is returned as a PanicError
+func (sf *Singleflight) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	c, leader := sf.join(key)
+	if leader {
+		sf.call(c, key, fn)
+	} else {
+		<-c.done
+	}
+	return c.val, c.err, sf.shared(c)
+}
+
+// DoContext is like Do, but the caller stops waiting if ctx is done, and
+// the error of ctx is returned. The in-flight call is not canceled with
+// the callers, fn gets a context which carries the values of the first
+// caller's ctx, such as the trace, and its deadline bounded by Timeout, so
+// the callers arriving later do not join a call which never returns
+func (sf *Singleflight) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	c, leader := sf.join(key)
+	if leader {
+		callCtx, cancel := sf.callContext(ctx)
+		go sf.call(c, key, func() (interface{}, error) {
+			defer cancel()
+			return fn(callCtx)
+		})
+	}
+	select {
+	case <-c.done:
+		return c.val, c.err, sf.shared(c)
+	case <-ctx.Done():
+		return nil, ctx.Err(), false
+	}
+}
+
+// callContext detaches ctx from the cancellation of the caller, but keeps
+// the deadline of it
+func (sf *Singleflight) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if sf.Timeout > 0 {
+		if d := time.Now().Add(sf.Timeout); !ok || d.Before(deadline) {
+			deadline, ok = d, true
+		}
+	}
+	callCtx := context.WithoutCancel(ctx)
+	if !ok {
+		return callCtx, func() {}
+	}
+	return context.WithDeadline(callCtx, deadline)
+}
+
+// Forget the in-flight call of the key, so the next call of the key starts
+// a new one instead of waiting for it
+func (sf *Singleflight) Forget(key string) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	delete(sf.calls, key)
+}
@@ -0,0 +1,162 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/leopoldxx/go-utils/trace"
+)
+
+func TestSingleflight(t *testing.T) {
+	var sf Singleflight
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "testvalue", nil
+	}
+
+	var wg sync.WaitGroup
+	var shared int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, s := sf.Do("testkey", fn)
+			if err != nil || v != "testvalue" {
+				t.Errorf("do testkey failed, got %v, %v", v, err)
+			}
+			if s {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 || shared != 10 {
+		t.Fatalf("dedup failed, expect 1 call & 10 shared, got %d, %d", calls, shared)
+	}
+
+	// not shared if there is only one caller
+	if _, _, s := sf.Do("testkey", fn); s || calls != 2 {
+		t.Fatalf("single call failed, got %v, %d", s, calls)
+	}
+
+	_, err, _ := sf.Do("panic", func() (interface{}, error) { panic("oops!") })
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "oops!" {
+		t.Fatalf("panic of the call failed, got %v", err)
+	}
+}
+
+func TestSingleflightForget(t *testing.T) {
+	var sf Singleflight
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go sf.Do("testkey", func() (interface{}, error) {
+		close(started)
+		<-release
+		return 1, nil
+	})
+	<-started
+
+	sf.Forget("testkey")
+	if v, _, s := sf.Do("testkey", func() (interface{}, error) { return 2, nil }); v != 2 || s {
+		t.Fatalf("do after forget failed, got %v, %v", v, s)
+	}
+	close(release)
+}
+
+func TestSingleflightContext(t *testing.T) {
+	var sf Singleflight
+	release := make(chan struct{})
+	var calls int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return trace.GetTraceFromContext(ctx).ID(), nil
+	}
+
+	ctx, cancel := context.WithCancel(trace.WithTraceForContext(context.Background(), "test", "test-trace-id"))
+	canceled := make(chan error)
+	go func() {
+		_, err, _ := sf.DoContext(ctx, "testkey", fn)
+		canceled <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	results := make(chan interface{})
+	go func() {
+		v, _, _ := sf.DoContext(context.Background(), "testkey", fn)
+		results <- v
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// the canceled caller stops waiting, but the call goes on for the others
+	cancel()
+	if err := <-canceled; err != context.Canceled {
+		t.Fatalf("canceled caller failed, got %v", err)
+	}
+	close(release)
+	if v := <-results; v != "test-trace-id" || calls != 1 {
+		t.Fatalf("shared call failed, got %v, %d", v, calls)
+	}
+}
+
+func TestSingleflightDeadline(t *testing.T) {
+	testCases := []struct {
+		name    string
+		timeout time.Duration
+		leader  time.Duration
+	}{
+		{"deadline", 0, 100 * time.Millisecond},
+		{"timeout", 100 * time.Millisecond, 0},
+	}
+	for _, tc := range testCases {
+		sf := Singleflight{Timeout: tc.timeout}
+		var calls int32
+		// the first call hangs until its context is done
+		fn := func(ctx context.Context) (interface{}, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return "testvalue", nil
+		}
+
+		ctx := context.Background()
+		if tc.leader > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tc.leader)
+			defer cancel()
+		}
+		if _, err, _ := sf.DoContext(ctx, "testkey", fn); err != context.DeadlineExceeded {
+			t.Fatalf("test key %s failed, expect %v, got %v", tc.name, context.DeadlineExceeded, err)
+		}
+
+		// the caller arriving later does not join the hung call
+		time.Sleep(50 * time.Millisecond)
+		results := make(chan interface{})
+		go func() {
+			v, _, _ := sf.DoContext(context.Background(), "testkey", fn)
+			results <- v
+		}()
+		select {
+		case v := <-results:
+			if v != "testvalue" || atomic.LoadInt32(&calls) != 2 {
+				t.Fatalf("test key %s failed, expect testvalue, got %v, %d", tc.name, v, calls)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("test key %s failed, the caller joins the hung call", tc.name)
+		}
+	}
+}
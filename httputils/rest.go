@@ -8,9 +8,11 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/leopoldxx/go-utils/concurrency"
 	"github.com/leopoldxx/go-utils/trace"
 )
 
@@ -40,6 +42,7 @@ type RestCli struct {
 	into     map[string]interface{}
 	debug    DebugLevel
 	isStream bool
+	sf       *concurrency.Singleflight
 }
 
 var defaultHTTPClient = func() *http.Client {
@@ -198,6 +201,53 @@ func (rest *RestCli) Debug(level ...DebugLevel) *RestCli {
 	return rest
 }
 
+// Singleflight shares the response among the concurrent identical GET
+// requests, the requests with a body or in stream mode are not shared. The
+// Timeout of sf bounds the shared requests whose context has no deadline
+func (rest *RestCli) Singleflight(sf *concurrency.Singleflight) *RestCli {
+	rest.sf = sf
+	return rest
+}
+
+// flightKey is the key of the request, the x-request-id is not a part of it
+func (rest *RestCli) flightKey() string {
+	headers := make([]string, 0, len(rest.headers))
+	for k, v := range rest.headers {
+		if k != "x-request-id" {
+			headers = append(headers, k+": "+v)
+		}
+	}
+	sort.Strings(headers)
+	return rest.method + " " + rest.api + "?" + rest.querys.Encode() + "\n" + strings.Join(headers, "\n")
+}
+
+// doShared does the request once for the concurrent identical requests, the
+// body is read into memory and every caller gets its own copy of the header
+// and the body
+func (rest *RestCli) doShared() (*Response, error) {
+	v, err, _ := rest.sf.DoContext(rest.ctx, rest.flightKey(), func(ctx context.Context) (interface{}, error) {
+		req, err := NewRequest(ctx, rest.method, rest.api, rest.headers, rest.querys, nil)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(rest.querys.Get("Connection"), "close") {
+			req.Close = true
+		}
+		return ClientDo(rest.cli, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	shared := v.(*Response)
+	body := append([]byte(nil), shared.Body...)
+	return &Response{
+		Status:     shared.Status,
+		Header:     shared.Header.Clone(),
+		Body:       body,
+		BodyStream: io.NopCloser(bytes.NewReader(body)),
+	}, nil
+}
+
 // Do will send the rest request to remote api and process the resp
 func (rest *RestCli) Do() (*Response, error) {
 	if rest.ctx == nil {
@@ -247,30 +297,45 @@ func (rest *RestCli) Do() (*Response, error) {
 		}
 	}
 
-	req, err := NewRequest(
-		rest.ctx,
-		rest.method,
-		rest.api,
-		rest.headers,
-		rest.querys,
-		bodyReader)
-	if err != nil {
-		if rest.debug >= Debug1 {
-			tracer.Error("create request failed:", err)
+	var (
+		resp *Response
+		err  error
+	)
+	if rest.sf != nil && rest.method == "GET" && bodyReader == nil && !rest.isStream {
+		resp, err = rest.doShared()
+		if err != nil {
+			if rest.debug >= Debug1 {
+				tracer.Error("do shared request failed:", err)
+			}
+			return nil, err
+		}
+	} else {
+		var req *http.Request
+		req, err = NewRequest(
+			rest.ctx,
+			rest.method,
+			rest.api,
+			rest.headers,
+			rest.querys,
+			bodyReader)
+		if err != nil {
+			if rest.debug >= Debug1 {
+				tracer.Error("create request failed:", err)
+			}
+			return nil, err
 		}
-		return nil, err
-	}
 
-	if strings.EqualFold(rest.querys.Get("Connection"), "close") {
-		req.Close = true
-	}
+		if strings.EqualFold(rest.querys.Get("Connection"), "close") {
+			req.Close = true
+		}
 
-	resp, err := ClientDo(rest.cli, req, true) // always return  a Body Reader, avoid memory copy
-	if err != nil {
-		if rest.debug >= Debug1 {
-			tracer.Error("do request failed:", err)
+		resp, err = ClientDo(rest.cli, req, true) // always return  a Body Reader, avoid memory copy
+		if err != nil {
+			if rest.debug >= Debug1 {
+				tracer.Error("do request failed:", err)
+			}
+			return nil, err
 		}
-		return nil, err
 	}
 	if rest.debug >= Debug1 {
 		tracer.Infof("resp status: %v, header: %v", resp.Status, resp.Header)
@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/leopoldxx/go-utils/concurrency"
 	"github.com/leopoldxx/go-utils/trace"
 )
 
@@ -97,3 +101,49 @@ func TestRest(t *testing.T) {
 
 	}
 }
+
+func TestRestSingleflight(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		body, _ := json.Marshal(&OKResp{Message: r.URL.Query().Get("name")})
+		w.Header().Set("X-Test", "testvalue")
+		w.Write(body)
+	}))
+	defer ts.Close()
+
+	sf := &concurrency.Singleflight{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := trace.WithTraceForContext(context.TODO(), "rest")
+			msgResp := &OKResp{}
+			resp, err := NewRestCli().
+				Context(ctx).
+				Get().
+				Host(ts.URL).
+				ResourcePath("/fake/get/path").
+				SetQuery("name", "world").
+				Singleflight(sf).
+				Into("2xx", msgResp).
+				Do()
+			if err != nil || resp.Status != http.StatusOK || msgResp.Message != "world" {
+				t.Errorf("shared request failed, got %v, %v, %v", resp, msgResp, err)
+				return
+			}
+			// every caller owns its header & body
+			if resp.Header.Get("X-Test") != "testvalue" || resp.Body[0] != '{' {
+				t.Errorf("shared response is modified, got %v, %q", resp.Header, resp.Body)
+			}
+			resp.Header.Set("X-Test", "modified")
+			resp.Body[0] = 'x'
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("requests should be shared, expect 1, got %d", calls)
+	}
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/leopoldxx/go-utils/cache"
+	"github.com/leopoldxx/go-utils/cache/counter"
+	"github.com/leopoldxx/go-utils/middleware"
+	"github.com/leopoldxx/go-utils/queue"
+)
+
+// the quantiles of the histograms
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+func withLabel(labels Labels, name, value string) Labels {
+	cp := copyLabels(labels)
+	cp[name] = value
+	return cp
+}
+
+// HistogramCollector collects the rolling histogram as a summary in seconds,
+// with the quantiles p50/p90/p99 over the windows, and the sum & count since
+// the histogram is created, so that they are cumulative like the counters
+func HistogramCollector(name, help string, labels Labels, h *counter.Histogram) Collector {
+	return CollectorFunc(func() []Family {
+		s := h.Snapshot()
+		count, sum := h.Total()
+		f := Family{Name: name, Help: help, Type: SummaryType}
+		for _, q := range quantiles {
+			f.Samples = append(f.Samples, Sample{
+				Labels: withLabel(labels, "quantile", strconv.FormatFloat(q, 'g', -1, 64)),
+				Value:  s.Percentile(q).Seconds(),
+			})
+		}
+		f.Samples = append(f.Samples,
+			Sample{Suffix: "_sum", Labels: labels, Value: sum.Seconds()},
+			Sample{Suffix: "_count", Labels: labels, Value: float64(count)},
+		)
+		return []Family{f}
+	})
+}
+
+// WindowCollector collects the rates per second of the named counters of the
+// rolling window as a gauge, the name of the counter is the label "counter"
+func WindowCollector(name, help string, labels Labels, w *counter.Window) Collector {
+	return CollectorFunc(func() []Family {
+		s := w.Snapshot()
+		f := Family{Name: name, Help: help, Type: GaugeType}
+		for _, counterName := range w.Names() {
+			f.Samples = append(f.Samples, Sample{
+				Labels: withLabel(labels, "counter", counterName),
+				Value:  s.Rate(counterName),
+			})
+		}
+		return []Family{f}
+	})
+}
+
+// CounterCollector collects the hits & misses in the window of the counter as
+// a gauge, they are labeled by "result"
+func CounterCollector(name, help string, labels Labels, c *counter.Counter) Collector {
+	return CollectorFunc(func() []Family {
+		hits, misses := c.Value()
+		return []Family{{
+			Name: name, Help: help, Type: GaugeType,
+			Samples: []Sample{
+				{Labels: withLabel(labels, "result", "hit"), Value: float64(hits)},
+				{Labels: withLabel(labels, "result", "miss"), Value: float64(misses)},
+			},
+		}}
+	})
+}
+
+// CacheCollector collects the stats of the cache, the name of the cache is
+// the label "cache"
+func CacheCollector(name string, c cache.Cache) Collector {
+	labels := Labels{"cache": name}
+	return CollectorFunc(func() []Family {
+		s := c.Stats()
+		families := []Family{
+			{Name: "cache_entries", Help: "Number of the entries in the cache.", Type: GaugeType,
+				Samples: []Sample{{Labels: labels, Value: float64(s.Len)}}},
+			{Name: "cache_cost", Help: "Total cost of the entries in the cache.", Type: GaugeType,
+				Samples: []Sample{{Labels: labels, Value: float64(s.Cost)}}},
+			{Name: "cache_hits_total", Help: "Number of the cache hits.", Type: CounterType,
+				Samples: []Sample{{Labels: labels, Value: float64(s.Hits)}}},
+			{Name: "cache_misses_total", Help: "Number of the cache misses.", Type: CounterType,
+				Samples: []Sample{{Labels: labels, Value: float64(s.Misses)}}},
+			{Name: "cache_window_hit_ratio", Help: "Hit ratio of the cache in the stats window.", Type: GaugeType,
+				Samples: []Sample{{Labels: labels, Value: s.WindowHitRatio}}},
+		}
+		evictions := Family{Name: "cache_evictions_total", Help: "Number of the evicted entries by the reason.", Type: CounterType}
+		for reason, n := range s.Evictions {
+			evictions.Samples = append(evictions.Samples, Sample{Labels: withLabel(labels, "reason", reason.String()), Value: float64(n)})
+		}
+		return append(families, evictions)
+	})
+}
+
+// QueueCollector collects the depth of the message queue, the name of the
+// queue is the label "queue"
+func QueueCollector(name string, q *queue.MsgQueue) Collector {
+	return CollectorFunc(func() []Family {
+		return []Family{{
+			Name: "queue_depth", Help: "Number of the messages waiting to be handled.", Type: GaugeType,
+			Samples: []Sample{{Labels: Labels{"queue": name}, Value: float64(q.Len())}},
+		}}
+	})
+}
+
+type httpRecorder struct {
+	r      *Registry
+	labels Labels
+	size   *Counter
+	// the response counters resolved by httpResponseKey
+	responses sync.Map
+}
+
+type httpResponseKey struct {
+	status int
+	cache  string
+}
+
+// NewHTTPRecorder will create a middleware.Recorder which counts the http
+// responses by the status code and the cache status, and the response sizes
+func NewHTTPRecorder(r *Registry, labels Labels) middleware.Recorder {
+	return &httpRecorder{
+		r:      r,
+		labels: labels,
+		size:   r.Counter("http_response_size_bytes_total", "Total size of the http response bodies.", labels),
+	}
+}
+
+func (hr *httpRecorder) Record(ctx context.Context, statistics middleware.Statistics) {
+	hr.responseCounter(statistics.Status, statistics.Cache).Inc()
+	hr.size.Add(float64(statistics.BodySize))
+}
+
+// responseCounter returns the counter of the status & cache, it is resolved
+// from the registry only once
+func (hr *httpRecorder) responseCounter(status int, cacheStatus string) *Counter {
+	key := httpResponseKey{status: status, cache: cacheStatus}
+	if c, ok := hr.responses.Load(key); ok {
+		return c.(*Counter)
+	}
+	labels := withLabel(hr.labels, "code", strconv.Itoa(status))
+	if len(cacheStatus) > 0 {
+		labels["cache"] = cacheStatus
+	}
+	c, _ := hr.responses.LoadOrStore(key, hr.r.Counter("http_responses_total", "Number of the http responses.", labels))
+	return c.(*Counter)
+}
+
+// RegisterCache adds the CacheCollector into the default registry
+func RegisterCache(name string, c cache.Cache) {
+	DefaultRegistry.Add(CacheCollector(name, c))
+}
+
+// RegisterQueue adds the QueueCollector into the default registry
+func RegisterQueue(name string, q *queue.MsgQueue) {
+	DefaultRegistry.Add(QueueCollector(name, q))
+}
+
+// NewHistogram creates a rolling histogram and adds it into the default registry
+func NewHistogram(name, help string, labels Labels, windows int, windowSize time.Duration) *counter.Histogram {
+	h := counter.NewHistogram(windows, windowSize)
+	DefaultRegistry.Add(HistogramCollector(name, help, labels, h))
+	return h
+}
@@ -0,0 +1,273 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Type of the metric family
+type Type string
+
+// metric types of the text exposition format
+const (
+	CounterType   Type = "counter"
+	GaugeType     Type = "gauge"
+	SummaryType   Type = "summary"
+	HistogramType Type = "histogram"
+)
+
+// Labels of the sample
+type Labels map[string]string
+
+// Sample is a value of the metric family, the Suffix is appended to the name
+// of the family, such as _sum and _count of the summary
+type Sample struct {
+	Suffix string
+	Labels Labels
+	Value  float64
+}
+
+// Family is a named group of the samples with the same type
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// Collector collects the metric families when the registry is scraped
+type Collector interface {
+	Collect() []Family
+}
+
+// CollectorFunc is a func Collector
+type CollectorFunc func() []Family
+
+// Collect the metric families
+func (f CollectorFunc) Collect() []Family {
+	return f()
+}
+
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Counter is a metric which only goes up
+type Counter struct {
+	bits uint64
+}
+
+// Inc the counter by one
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add v to the counter, the negative v is ignored
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	addFloat(&c.bits, v)
+}
+
+// Value of the counter
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+// Gauge is a metric which can go up and down
+type Gauge struct {
+	bits uint64
+}
+
+// Set the gauge
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Add v to the gauge
+func (g *Gauge) Add(v float64) {
+	addFloat(&g.bits, v)
+}
+
+// Value of the gauge
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func addFloat(bits *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		if atomic.CompareAndSwapUint64(bits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+type series struct {
+	labels Labels
+	value  func() float64
+}
+
+type family struct {
+	name   string
+	help   string
+	typ    Type
+	series map[string]*series
+	// the counter or gauge of the series
+	metrics map[string]interface{}
+}
+
+// Registry holds the metrics and the collectors, it is safe for concurrent use
+type Registry struct {
+	sync.RWMutex
+	families   map[string]*family
+	collectors []Collector
+}
+
+// NewRegistry will create an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// DefaultRegistry is the registry used by the package level helpers
+var DefaultRegistry = NewRegistry()
+
+// labelsKey is the unique key of the labels
+func labelsKey(labels Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s=%q,", name, labels[name])
+	}
+	return sb.String()
+}
+
+func copyLabels(labels Labels) Labels {
+	cp := make(Labels, len(labels))
+	for k, v := range labels {
+		cp[k] = v
+	}
+	return cp
+}
+
+// metric gets or creates the series of the family, it panics if the name is
+// invalid or it is registered with another type
+func (r *Registry) metric(name, help string, typ Type, labels Labels, create func() (interface{}, func() float64)) interface{} {
+	if !nameRegexp.MatchString(name) {
+		panic(fmt.Sprintf("invalid metric name %q", name))
+	}
+	for label := range labels {
+		if !nameRegexp.MatchString(label) || strings.HasPrefix(label, "__") {
+			panic(fmt.Sprintf("invalid label name %q of metric %s", label, name))
+		}
+	}
+	key := labelsKey(labels)
+
+	r.Lock()
+	defer r.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, typ: typ, series: map[string]*series{}, metrics: map[string]interface{}{}}
+		r.families[name] = f
+	}
+	if f.typ != typ {
+		panic(fmt.Sprintf("metric %s is registered as %s, not %s", name, f.typ, typ))
+	}
+	if m, ok := f.metrics[key]; ok {
+		return m
+	}
+	m, value := create()
+	f.series[key] = &series{labels: copyLabels(labels), value: value}
+	f.metrics[key] = m
+	return m
+}
+
+// Counter gets or creates the counter with the name and labels
+func (r *Registry) Counter(name, help string, labels Labels) *Counter {
+	return r.metric(name, help, CounterType, labels, func() (interface{}, func() float64) {
+		c := &Counter{}
+		return c, c.Value
+	}).(*Counter)
+}
+
+// Gauge gets or creates the gauge with the name and labels
+func (r *Registry) Gauge(name, help string, labels Labels) *Gauge {
+	return r.metric(name, help, GaugeType, labels, func() (interface{}, func() float64) {
+		g := &Gauge{}
+		return g, g.Value
+	}).(*Gauge)
+}
+
+// GaugeFunc registers a gauge whose value is f() when it is scraped, the
+// gauge with the same name and labels is only registered once
+func (r *Registry) GaugeFunc(name, help string, labels Labels, f func() float64) {
+	r.metric(name, help, GaugeType, labels, func() (interface{}, func() float64) {
+		return f, f
+	})
+}
+
+// CounterFunc registers a counter whose value is f() when it is scraped, the
+// counter with the same name and labels is only registered once
+func (r *Registry) CounterFunc(name, help string, labels Labels, f func() float64) {
+	r.metric(name, help, CounterType, labels, func() (interface{}, func() float64) {
+		return f, f
+	})
+}
+
+// Add a collector into the registry
+func (r *Registry) Add(c Collector) {
+	r.Lock()
+	defer r.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Gather collects all the metric families, the families with the same name
+// are merged, and they are sorted by the name
+func (r *Registry) Gather() []Family {
+	r.RLock()
+	families := make([]Family, 0, len(r.families))
+	for _, f := range r.families {
+		family := Family{Name: f.name, Help: f.help, Type: f.typ}
+		for _, s := range f.series {
+			family.Samples = append(family.Samples, Sample{Labels: s.labels, Value: s.value()})
+		}
+		families = append(families, family)
+	}
+	collectors := append([]Collector(nil), r.collectors...)
+	r.RUnlock()
+
+	// the collectors are called without the lock, so they can use the registry
+	for _, c := range collectors {
+		families = append(families, c.Collect()...)
+	}
+
+	merged := map[string]int{}
+	result := make([]Family, 0, len(families))
+	for _, f := range families {
+		if idx, ok := merged[f.Name]; ok {
+			result[idx].Samples = append(result[idx].Samples, f.Samples...)
+			continue
+		}
+		merged[f.Name] = len(result)
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	for idx := range result {
+		samples := result[idx].Samples
+		sort.SliceStable(samples, func(i, j int) bool {
+			if samples[i].Suffix != samples[j].Suffix {
+				return samples[i].Suffix < samples[j].Suffix
+			}
+			return labelsKey(samples[i].Labels) < labelsKey(samples[j].Labels)
+		})
+	}
+	return result
+}
@@ -0,0 +1,170 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/leopoldxx/go-utils/cache"
+	"github.com/leopoldxx/go-utils/cache/counter"
+	. "github.com/leopoldxx/go-utils/metrics"
+	"github.com/leopoldxx/go-utils/middleware"
+	"github.com/leopoldxx/go-utils/queue"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.Counter("test_requests_total", "Number of the requests.", Labels{"method": "GET"}).Inc()
+			r.Counter("test_requests_total", "Number of the requests.", Labels{"method": "POST"}).Add(2)
+			r.Gauge("test_temperature", "Temperature.", nil).Set(-1.5)
+		}(i)
+	}
+	wg.Wait()
+	r.GaugeFunc("test_goroutines", "Goroutines with \\ and\nnew line.", Labels{"path": `C:\dir "x"`}, func() float64 { return 3 })
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, r.Gather()); err != nil {
+		t.Fatal("write text failed:", err)
+	}
+	expect := `# HELP test_goroutines Goroutines with \\ and\nnew line.
+# TYPE test_goroutines gauge
+test_goroutines{path="C:\\dir \"x\""} 3
+# HELP test_requests_total Number of the requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET"} 10
+test_requests_total{method="POST"} 20
+# HELP test_temperature Temperature.
+# TYPE test_temperature gauge
+test_temperature -1.5
+`
+	if buf.String() != expect {
+		t.Fatalf("text failed, expect:\n%s\ngot:\n%s", expect, buf.String())
+	}
+
+	for _, f := range []func(){
+		func() { r.Gauge("test_requests_total", "", nil) },
+		func() { r.Counter("test-invalid", "", nil) },
+		func() { r.Counter("test_invalid", "", Labels{"__name": "x"}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("the invalid metric should panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestCollectors(t *testing.T) {
+	r := NewRegistry()
+
+	users, orders := cache.NewCache(), cache.NewCache()
+	defer users.Close()
+	defer orders.Close()
+	users.Put("testkey", "testvalue")
+	users.Get("testkey")
+	users.Get("nothing")
+	users.Del("testkey")
+	r.Add(CacheCollector("users", users))
+	r.Add(CacheCollector("orders", orders))
+
+	mq := queue.NewMsgQueue()
+	mq.Pub("topic", []byte("data"))
+	r.Add(QueueCollector("events", mq))
+
+	h := counter.NewHistogram(1, time.Minute)
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	r.Add(HistogramCollector("test_latency_seconds", "Latency.", Labels{"api": "list"}, h))
+
+	w := counter.NewWindow(10, time.Second)
+	w.Add("requests", 5)
+	r.Add(WindowCollector("test_rate", "Rate.", nil, w))
+
+	c := counter.New(10)
+	c.Hit()
+	c.Hit()
+	c.Miss()
+	r.Add(CounterCollector("test_lookups", "Lookups.", Labels{"api": "list"}, c))
+
+	recorder := NewHTTPRecorder(r, Labels{"server": "test"})
+	recorder.Record(context.Background(), middleware.Statistics{Status: 200, BodySize: 10, Cache: middleware.CacheHit})
+	recorder.Record(context.Background(), middleware.Statistics{Status: 200, BodySize: 5})
+
+	router := mux.NewRouter()
+	r.Register(router)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest("GET", "http://example.com/metrics", nil))
+	if resp.Code != 200 || resp.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("metrics api failed, got %d, %s", resp.Code, resp.Header().Get("Content-Type"))
+	}
+	text := resp.Body.String()
+
+	for _, line := range []string{
+		`cache_entries{cache="orders"} 0`,
+		`cache_hits_total{cache="users"} 1`,
+		`cache_misses_total{cache="users"} 1`,
+		`cache_evictions_total{cache="users",reason="deleted"} 1`,
+		`queue_depth{queue="events"} 1`,
+		`test_latency_seconds_count{api="list"} 100`,
+		`http_responses_total{cache="hit",code="200",server="test"} 1`,
+		`http_responses_total{code="200",server="test"} 1`,
+		`http_response_size_bytes_total{server="test"} 15`,
+		`test_lookups{api="list",result="hit"} 2`,
+		`test_lookups{api="list",result="miss"} 1`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("test key %s failed, got:\n%s", line, text)
+		}
+	}
+	if n := strings.Count(text, "# TYPE cache_entries gauge"); n != 1 {
+		t.Fatalf("families should be merged, got %d", n)
+	}
+	for _, prefix := range []string{`test_latency_seconds{api="list",quantile="0.5"} 0.05`, `test_rate{counter="requests"} `} {
+		if !strings.Contains(text, prefix) {
+			t.Fatalf("test key %s failed, got:\n%s", prefix, text)
+		}
+	}
+}
+
+func TestHistogramCollector(t *testing.T) {
+	clock := counter.NewFakeClock(time.Unix(1000, 0))
+	h := counter.NewHistogram(1, time.Second, counter.WithClock(clock))
+	r := NewRegistry()
+	r.Add(HistogramCollector("test_latency_seconds", "Latency.", nil, h))
+
+	for i := 0; i < 10; i++ {
+		h.Record(time.Second)
+	}
+	// the quantiles are of the last window, the sum & count are cumulative
+	clock.Advance(time.Second)
+	h.Record(0)
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf, r.Gather()); err != nil {
+		t.Fatal("write text failed:", err)
+	}
+	for _, line := range []string{
+		`test_latency_seconds{quantile="0.99"} 0`,
+		`test_latency_seconds_sum 10`,
+		`test_latency_seconds_count 11`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Fatalf("test key %s failed, got:\n%s", line, buf.String())
+		}
+	}
+}
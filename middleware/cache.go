@@ -0,0 +1,339 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leopoldxx/go-utils/cache"
+)
+
+// cache status of the response, labeled in the Statistics
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// DefaultResponseCacheTTL is used if the response has no max-age
+const DefaultResponseCacheTTL = time.Minute
+
+type cacheOptions struct {
+	queries []string
+	headers []string
+	ttl     time.Duration
+}
+
+// CacheOption for the ResponseCache middleware
+type CacheOption func(opts *cacheOptions)
+
+// VaryByQuery adds the query values into the cache key
+func VaryByQuery(names ...string) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.queries = append(opts.queries, names...)
+	}
+}
+
+// VaryByHeader adds the request header values into the cache key
+func VaryByHeader(names ...string) CacheOption {
+	return func(opts *cacheOptions) {
+		for _, name := range names {
+			opts.headers = append(opts.headers, http.CanonicalHeaderKey(name))
+		}
+	}
+}
+
+// CacheTTL sets the cache time of the responses without max-age
+func CacheTTL(ttl time.Duration) CacheOption {
+	return func(opts *cacheOptions) {
+		opts.ttl = ttl
+	}
+}
+
+type cachedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+	etag   string
+	// shared is true if the response is public or has s-maxage
+	shared bool
+}
+
+// varyHeaders is cached with the key of the request if the response has
+// Vary, the responses are cached with the key plus the values of them
+type varyHeaders []string
+
+// ResponseCache will create a middleware which caches the GET responses in c.
+// The responses with Cache-Control no-store or private are not cached, and
+// the max-age of the response is used as the cache time if it exists.
+// The requests with Authorization and the responses with Set-Cookie bypass
+// the cache, unless the response is public or has s-maxage, the Set-Cookie
+// is not stored in that case. The Vary of the response is honored.
+// The ETag is generated if the handler does not set one, and 304 is returned
+// if it matches the If-None-Match of the request
+func ResponseCache(c cache.Cache, opts ...CacheOption) Middleware {
+	options := cacheOptions{ttl: DefaultResponseCacheTTL}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next(w, r)
+				return
+			}
+			reqDirectives := parseCacheControl(r.Header.Get("Cache-Control"))
+			if _, ok := reqDirectives["no-store"]; ok {
+				next(w, r)
+				return
+			}
+
+			key := options.key(r)
+			// no-cache & max-age=0 of the request skip the cached response
+			_, noCache := reqDirectives["no-cache"]
+			if maxAge, ok := reqDirectives["max-age"]; ok && maxAge == "0" {
+				noCache = true
+			}
+			if !noCache {
+				if resp, ok := lookup(c, key, r); ok {
+					setCacheStatus(w, CacheHit)
+					resp.writeTo(w, r)
+					return
+				}
+			}
+			setCacheStatus(w, CacheMiss)
+
+			bw := &bufferedWriter{header: http.Header{}, status: http.StatusOK}
+			next(bw, r)
+			resp := &cachedResponse{status: bw.status, header: bw.header, body: bw.body.Bytes()}
+			resp.shared = isShared(resp.header)
+			if resp.status == http.StatusOK {
+				resp.etag = resp.header.Get("ETag")
+				if len(resp.etag) == 0 {
+					sum := sha1.Sum(resp.body)
+					resp.etag = `"` + hex.EncodeToString(sum[:]) + `"`
+					resp.header.Set("ETag", resp.etag)
+				}
+				if ttl, ok := options.cacheTime(r, resp); ok {
+					store(c, key, r, resp, ttl)
+				}
+			}
+			resp.writeTo(w, r)
+		}
+	}
+}
+
+func (opts *cacheOptions) key(r *http.Request) string {
+	var sb strings.Builder
+	sb.WriteString(r.Method)
+	sb.WriteString(" ")
+	sb.WriteString(r.URL.Path)
+
+	if len(opts.queries) > 0 {
+		query, values := r.URL.Query(), url.Values{}
+		for _, name := range opts.queries {
+			if v, ok := query[name]; ok {
+				values[name] = v
+			}
+		}
+		sb.WriteString("?")
+		sb.WriteString(values.Encode())
+	}
+	writeHeaders(&sb, opts.headers, r)
+	return sb.String()
+}
+
+func (vh varyHeaders) key(key string, r *http.Request) string {
+	var sb strings.Builder
+	sb.WriteString(key)
+	writeHeaders(&sb, vh, r)
+	return sb.String()
+}
+
+func writeHeaders(sb *strings.Builder, names []string, r *http.Request) {
+	for _, name := range names {
+		sb.WriteString("\n")
+		sb.WriteString(name)
+		sb.WriteString(": ")
+		sb.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+}
+
+// parseVary returns the canonical names of the Vary headers
+func parseVary(header http.Header) varyHeaders {
+	var vh varyHeaders
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				vh = append(vh, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(vh)
+	return vh
+}
+
+func lookup(c cache.Cache, key string, r *http.Request) (*cachedResponse, bool) {
+	v, ok := c.Get(key)
+	if vh, isVary := v.(varyHeaders); ok && isVary {
+		v, ok = c.Get(vh.key(key, r))
+	}
+	if !ok {
+		return nil, false
+	}
+	resp, ok := v.(*cachedResponse)
+	// only the shared responses are served to the authorized requests
+	if ok && !resp.shared && len(r.Header.Get("Authorization")) > 0 {
+		return nil, false
+	}
+	return resp, ok
+}
+
+func store(c cache.Cache, key string, r *http.Request, resp *cachedResponse, ttl time.Duration) {
+	// the cookie is set for the current client only, never replay it to others
+	if len(resp.header.Values("Set-Cookie")) > 0 {
+		stored := *resp
+		stored.header = resp.header.Clone()
+		stored.header.Del("Set-Cookie")
+		resp = &stored
+	}
+	vh := parseVary(resp.header)
+	if len(vh) == 0 {
+		c.PutWithTimeout(key, resp, ttl)
+		return
+	}
+	c.PutWithTimeout(key, vh, ttl)
+	c.PutWithTimeout(vh.key(key, r), resp, ttl)
+}
+
+func isShared(header http.Header) bool {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	_, public := directives["public"]
+	_, sMaxAge := directives["s-maxage"]
+	return public || sMaxAge
+}
+
+func (opts *cacheOptions) cacheTime(r *http.Request, resp *cachedResponse) (time.Duration, bool) {
+	header := resp.header
+	// the responses of a user are not shared unless they are marked so
+	if !resp.shared && (len(r.Header.Get("Authorization")) > 0 || len(header.Values("Set-Cookie")) > 0) {
+		return 0, false
+	}
+	for _, name := range parseVary(header) {
+		if name == "*" {
+			return 0, false
+		}
+	}
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[d]; ok {
+			return 0, false
+		}
+	}
+	// s-maxage is for the shared caches, it overrides the max-age
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, ok := directives[d]; ok {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return opts.ttl, opts.ttl > 0
+}
+
+func (resp *cachedResponse) writeTo(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	if len(resp.etag) > 0 && etagMatch(r.Header.Get("If-None-Match"), resp.etag) {
+		header.Set("ETag", resp.etag)
+		if cc := resp.header.Get("Cache-Control"); len(cc) > 0 {
+			header.Set("Cache-Control", cc)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	for k, v := range resp.header {
+		header[k] = v
+	}
+	w.WriteHeader(resp.status)
+	w.Write(resp.body)
+}
+
+// etagMatch uses the weak comparison of the If-None-Match
+func etagMatch(ifNoneMatch, etag string) bool {
+	if len(ifNoneMatch) == 0 {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCacheControl(cc string) map[string]string {
+	directives := map[string]string{}
+	for _, d := range strings.Split(cc, ",") {
+		d = strings.TrimSpace(d)
+		if len(d) == 0 {
+			continue
+		}
+		name, value, _ := strings.Cut(d, "=")
+		directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return directives
+}
+
+// cacheStatusSetter labels the cache status in the Statistics
+type cacheStatusSetter interface {
+	setCacheStatus(status string)
+}
+
+// setCacheStatus follows the Unwrap of the writers wrapping the responseWriter
+func setCacheStatus(w http.ResponseWriter, status string) {
+	for {
+		switch rw := w.(type) {
+		case cacheStatusSetter:
+			rw.setCacheStatus(status)
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+// bufferedWriter holds the response until the handler returns, so that the
+// ETag can be set and the response can be cached
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (bw *bufferedWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *bufferedWriter) Write(data []byte) (int, error) {
+	bw.wrote = true
+	return bw.body.Write(data)
+}
+
+func (bw *bufferedWriter) WriteHeader(status int) {
+	if !bw.wrote {
+		bw.status = status
+		bw.wrote = true
+	}
+}
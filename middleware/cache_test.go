@@ -0,0 +1,302 @@
+package middleware_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/leopoldxx/go-utils/cache"
+	. "github.com/leopoldxx/go-utils/middleware"
+)
+
+type statsRecorder struct {
+	sync.Mutex
+	stats []Statistics
+}
+
+func (sr *statsRecorder) Record(ctx context.Context, statistics Statistics) {
+	sr.Lock()
+	defer sr.Unlock()
+	sr.stats = append(sr.stats, statistics)
+}
+
+func (sr *statsRecorder) last() Statistics {
+	sr.Lock()
+	defer sr.Unlock()
+	return sr.stats[len(sr.stats)-1]
+}
+
+func TestResponseCache(t *testing.T) {
+	recorder := &statsRecorder{}
+	SetDefaultResponseInterceptor(recorder)
+	defer SetDefaultResponseInterceptor(nil)
+
+	c := cache.NewCache()
+	defer c.Close()
+
+	calls := 0
+	hh := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private")
+		case "/short":
+			w.Header().Set("Cache-Control", "max-age=0")
+		}
+		fmt.Fprintf(w, "page %s", r.URL.Query().Get("page"))
+	}
+	handler := Chain(RecoverWithTrace("cache_test"), ResponseCache(c, VaryByQuery("page"))).HandlerFunc(hh)
+
+	do := func(method, target string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://example.com"+target, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	testCases := []struct {
+		method      string
+		target      string
+		header      map[string]string
+		expectCode  int
+		expectBody  string
+		expectCache string
+		expectCalls int
+	}{
+		{"GET", "/foo?page=1", nil, 200, "page 1", CacheMiss, 1},
+		{"GET", "/foo?page=1&other=1", nil, 200, "page 1", CacheHit, 1},
+		{"GET", "/foo?page=2", nil, 200, "page 2", CacheMiss, 2},
+		{"GET", "/foo?page=1", map[string]string{"Cache-Control": "no-store"}, 200, "page 1", "", 3},
+		{"GET", "/foo?page=1", map[string]string{"Cache-Control": "no-cache"}, 200, "page 1", CacheMiss, 4},
+		{"POST", "/foo?page=1", nil, 200, "page 1", "", 5},
+		{"GET", "/private", nil, 200, "page ", CacheMiss, 6},
+		{"GET", "/private", nil, 200, "page ", CacheMiss, 7},
+		{"GET", "/short", nil, 200, "page ", CacheMiss, 8},
+		{"GET", "/short", nil, 200, "page ", CacheMiss, 9},
+	}
+	for idx, tc := range testCases {
+		w := do(tc.method, tc.target, tc.header)
+		if w.Code != tc.expectCode || w.Body.String() != tc.expectBody {
+			t.Fatalf("test case %d failed, expect %d %q, got %d %q", idx, tc.expectCode, tc.expectBody, w.Code, w.Body.String())
+		}
+		if s := recorder.last(); s.Cache != tc.expectCache {
+			t.Fatalf("test case %d failed, expect cache %q, got %q", idx, tc.expectCache, s.Cache)
+		}
+		if calls != tc.expectCalls {
+			t.Fatalf("test case %d failed, expect calls %d, got %d", idx, tc.expectCalls, calls)
+		}
+	}
+
+	etag := do("GET", "/foo?page=1", nil).Header().Get("ETag")
+	if len(etag) == 0 {
+		t.Fatal("etag should be generated")
+	}
+	for _, inm := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		w := do("GET", "/foo?page=1", map[string]string{"If-None-Match": inm})
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+			t.Fatalf("if-none-match %s failed, got %d %q", inm, w.Code, w.Body.String())
+		}
+	}
+	if w := do("GET", "/foo?page=1", map[string]string{"If-None-Match": `"other"`}); w.Code != http.StatusOK {
+		t.Fatalf("if-none-match of other etag failed, got %d", w.Code)
+	}
+}
+
+func TestResponseCacheVaryByHeader(t *testing.T) {
+	c := cache.NewCache()
+	defer c.Close()
+
+	hh := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}
+	handler := ResponseCache(c, VaryByHeader("accept-language")).HandlerFunc(hh)
+
+	for _, lang := range []string{"en", "zh", "en"} {
+		req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+		req.Header.Set("Accept-Language", lang)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Body.String() != lang {
+			t.Fatalf("test key %s failed, expect %s, got %s", lang, lang, w.Body.String())
+		}
+	}
+	if c.Len() != 2 {
+		t.Fatalf("cached responses failed, expect 2, got %d", c.Len())
+	}
+}
+
+func TestResponseCacheAuthorization(t *testing.T) {
+	c := cache.NewCache()
+	defer c.Close()
+
+	calls := 0
+	hh := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/public":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		case "/shared":
+			w.Header().Set("Cache-Control", "s-maxage=60")
+			w.Header().Set("Set-Cookie", "session=1")
+		case "/cookie":
+			w.Header().Set("Set-Cookie", "session=1")
+		}
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}
+	handler := ResponseCache(c).HandlerFunc(hh)
+
+	testCases := []struct {
+		target      string
+		auth        string
+		expectBody  string
+		expectCalls int
+	}{
+		{"/foo", "user1", "user1", 1},
+		{"/foo", "user2", "user2", 2},
+		{"/foo", "", "", 3},
+		{"/foo", "", "", 3},
+		// the cached response is not served to the authorized requests
+		{"/foo", "user1", "user1", 4},
+		{"/public", "user1", "user1", 5},
+		{"/public", "user2", "user1", 5},
+		{"/shared", "", "", 6},
+		{"/shared", "", "", 6},
+		{"/cookie", "", "", 7},
+		{"/cookie", "", "", 8},
+	}
+	for idx, tc := range testCases {
+		req := httptest.NewRequest("GET", "http://example.com"+tc.target, nil)
+		if len(tc.auth) > 0 {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Body.String() != tc.expectBody || calls != tc.expectCalls {
+			t.Fatalf("test case %d failed, expect %q %d, got %q %d", idx, tc.expectBody, tc.expectCalls, w.Body.String(), calls)
+		}
+	}
+}
+
+func TestResponseCacheSetCookie(t *testing.T) {
+	c := cache.NewCache()
+	defer c.Close()
+
+	calls := 0
+	hh := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Header().Set("Set-Cookie", "session="+r.Header.Get("Authorization"))
+		w.Write([]byte("public"))
+	}
+	handler := ResponseCache(c).HandlerFunc(hh)
+
+	testCases := []struct {
+		auth         string
+		expectCookie string
+		expectCalls  int
+	}{
+		{"user1", "session=user1", 1},
+		// the cookie of user1 is not replayed to the others
+		{"user2", "", 1},
+		{"", "", 1},
+	}
+	for idx, tc := range testCases {
+		req := httptest.NewRequest("GET", "http://example.com/public", nil)
+		if len(tc.auth) > 0 {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		cookie := w.Header().Get("Set-Cookie")
+		if w.Body.String() != "public" || cookie != tc.expectCookie || calls != tc.expectCalls {
+			t.Fatalf("test case %d failed, expect %q %d, got %q %d", idx, tc.expectCookie, tc.expectCalls, cookie, calls)
+		}
+	}
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	c := cache.NewCache()
+	defer c.Close()
+
+	calls := 0
+	hh := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/any" {
+			w.Header().Set("Vary", "*")
+		} else {
+			w.Header().Set("Vary", "accept-encoding, Accept-Language")
+		}
+		w.Write([]byte(r.Header.Get("Accept-Language") + r.Header.Get("Accept-Encoding")))
+	}
+	handler := ResponseCache(c).HandlerFunc(hh)
+
+	testCases := []struct {
+		target      string
+		lang        string
+		encoding    string
+		expectBody  string
+		expectCalls int
+	}{
+		{"/foo", "en", "", "en", 1},
+		{"/foo", "zh", "", "zh", 2},
+		{"/foo", "en", "", "en", 2},
+		{"/foo", "en", "gzip", "engzip", 3},
+		{"/foo", "zh", "", "zh", 3},
+		{"/any", "en", "", "en", 4},
+		{"/any", "en", "", "en", 5},
+	}
+	for idx, tc := range testCases {
+		req := httptest.NewRequest("GET", "http://example.com"+tc.target, nil)
+		req.Header.Set("Accept-Language", tc.lang)
+		if len(tc.encoding) > 0 {
+			req.Header.Set("Accept-Encoding", tc.encoding)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Body.String() != tc.expectBody || calls != tc.expectCalls {
+			t.Fatalf("test case %d failed, expect %q %d, got %q %d", idx, tc.expectBody, tc.expectCalls, w.Body.String(), calls)
+		}
+	}
+}
+
+// unwrapWriter is a writer of the other middlewares wrapping the writer
+type unwrapWriter struct {
+	http.ResponseWriter
+}
+
+func (uw unwrapWriter) Unwrap() http.ResponseWriter {
+	return uw.ResponseWriter
+}
+
+func TestResponseCacheWrappedWriter(t *testing.T) {
+	recorder := &statsRecorder{}
+	SetDefaultResponseInterceptor(recorder)
+	defer SetDefaultResponseInterceptor(nil)
+
+	c := cache.NewCache()
+	defer c.Close()
+
+	wrap := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next(unwrapWriter{w}, r)
+		}
+	}
+	hh := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("testvalue"))
+	}
+	handler := Chain(RecoverWithTrace("cache_test"), wrap, ResponseCache(c)).HandlerFunc(hh)
+
+	for _, expect := range []string{CacheMiss, CacheHit} {
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/foo", nil))
+		if s := recorder.last(); s.Cache != expect {
+			t.Fatalf("test key %s failed, expect %s, got %s", expect, expect, s.Cache)
+		}
+	}
+}
@@ -21,6 +21,7 @@ type responseWriter struct {
 
 	status int
 	size   int
+	cache  string
 }
 
 func (rs *responseWriter) Header() http.Header {
@@ -41,6 +42,12 @@ func (rs *responseWriter) WriteHeader(status int) {
 	rs.ResponseWriter.WriteHeader(status)
 }
 
+func (rs *responseWriter) setCacheStatus(status string) {
+	rs.Lock()
+	rs.cache = status
+	rs.Unlock()
+}
+
 // Recorder for http handler response status & body size
 type Recorder interface {
 	Record(ctx context.Context, statistics Statistics)
@@ -83,6 +90,8 @@ func (mr multiRecorder) Record(ctx context.Context, statistics Statistics) {
 type Statistics struct {
 	Status   int
 	BodySize int
+	// Cache is CacheHit or CacheMiss if the response is served by ResponseCache
+	Cache string
 }
 
 func (rs *responseWriter) Record(ctx context.Context, recorder Recorder) {
@@ -90,6 +99,7 @@ func (rs *responseWriter) Record(ctx context.Context, recorder Recorder) {
 	rs.Lock()
 	s.Status = rs.status
 	s.BodySize = rs.size
+	s.Cache = rs.cache
 	rs.Unlock()
 	if recorder != nil {
 		recorder.Record(ctx, s)
@@ -12,6 +12,7 @@ import (
 	"github.com/VividCortex/mysqlerr"
 	gomysql "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	"github.com/leopoldxx/go-utils/concurrency"
 	"github.com/leopoldxx/go-utils/errors"
 	"github.com/leopoldxx/go-utils/trace"
 	uuid "github.com/satori/go.uuid"
@@ -26,7 +27,8 @@ type options struct {
 	maxOpenConnsCount int
 	maxIdleConnsCount int
 	// for operation
-	extra string
+	extra        string
+	singleflight *concurrency.Singleflight
 }
 
 // Option for MySQL Client
@@ -190,6 +192,48 @@ func formatSelectParameters(table string, rowFields []Field, whereClause []Where
 	}()), whereFieldsValue, nil
 }
 
+// WithSingleflight shares the rows among the concurrent identical selects,
+// it only works without transaction. The rows are copied into every result,
+// but the pointers inside the rows are shared
+func WithSingleflight(sf *concurrency.Singleflight) Option {
+	return func(opts *options) {
+		opts.singleflight = sf
+	}
+}
+
+func selectShared(ctx context.Context, sf *concurrency.Singleflight, db *sqlx.DB, result interface{}, sqlTpl string, fieldsValue []interface{}) error {
+	typ := reflect.TypeOf(result)
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		return errors.NewBadRequestError("the result must be a pointer")
+	}
+	// the db and the type of the result are parts of the key, so the shared
+	// rows are of the same database and can be set into every result. The
+	// types of the values are kept, so 1 and "1" are different
+	var key strings.Builder
+	fmt.Fprintf(&key, "%p %s %s", db, typ, sqlTpl)
+	for _, v := range fieldsValue {
+		fmt.Fprintf(&key, " %T:%#v", v, v)
+	}
+	v, err, _ := sf.DoContext(ctx, key.String(), func(ctx context.Context) (interface{}, error) {
+		rows := reflect.New(typ.Elem())
+		if err := db.SelectContext(ctx, rows.Interface(), sqlTpl, fieldsValue...); err != nil {
+			return nil, err
+		}
+		return rows.Elem(), nil
+	})
+	if err != nil {
+		return err
+	}
+	rows := v.(reflect.Value)
+	if rows.Kind() == reflect.Slice {
+		cp := reflect.MakeSlice(rows.Type(), rows.Len(), rows.Len())
+		reflect.Copy(cp, rows)
+		rows = cp
+	}
+	reflect.ValueOf(result).Elem().Set(rows)
+	return nil
+}
+
 // SelectRows is a util function to select some rows from a table
 func SelectRows(ctx context.Context, db *sqlx.DB, tx *sqlx.Tx, table string, fields []Field, whereClause []WhereClause, result interface{}, ops ...Option) error {
 	opts := &options{}
@@ -206,7 +250,9 @@ func SelectRows(ctx context.Context, db *sqlx.DB, tx *sqlx.Tx, table string, fie
 		sqlTpl = sqlTpl + " " + opts.extra
 	}
 
-	if db != nil {
+	if db != nil && opts.singleflight != nil {
+		err = selectShared(ctx, opts.singleflight, db, result, sqlTpl, fieldsValue)
+	} else if db != nil {
 		err = db.Select(result, sqlTpl, fieldsValue...)
 	} else if tx != nil {
 		err = tx.Select(result, sqlTpl, fieldsValue...)
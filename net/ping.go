@@ -84,13 +84,9 @@ func sendEchoMessage(conn *icmp.PacketConn, wg *sync.WaitGroup, cb *concurrency.
 
 func (p pinger) sendEchoMessages(ctx context.Context, wg *sync.WaitGroup, cb *concurrency.Barrier, conn *icmp.PacketConn, ips []string) {
 	for i := range ips {
-		select {
-		case <-ctx.Done():
-			return
-		default:
+		if err := cb.AdvanceContext(ctx); err != nil {
+			break
 		}
-
-		cb.Advance()
 		wg.Add(1)
 		go sendEchoMessage(conn, wg, cb, net.ParseIP(ips[i]).To4())
 	}
@@ -114,7 +110,10 @@ func (p pinger) recvEchoReplyMessage(ctx context.Context, cb *concurrency.Barrie
 
 	go func(retry <-chan string) {
 		for ip := range retry {
-			cb.Advance()
+			// the retries are dropped after the ttl, the channel is still drained
+			if err := cb.AdvanceContext(newCtx); err != nil {
+				continue
+			}
 			go sendEchoMessage(conn, nil, cb, net.ParseIP(ip).To4())
 		}
 	}(retryCh)
@@ -84,6 +84,11 @@ func (mq *MsgQueue) Handlers() map[string]map[Handler]UnSub {
 	return mq.handlers
 }
 
+// Len returns the number of the messages waiting to be handled
+func (mq *MsgQueue) Len() int {
+	return len(mq.data)
+}
+
 // Stop the message queue
 func (mq *MsgQueue) Stop() {
 	mq.stopCancel()
@@ -144,7 +149,11 @@ func (mq *MsgQueue) Run() {
 			close(mq.data)
 			return
 		case msg := <-mq.data:
-			handleBarrier.Advance()
+			// do not hang on the barrier if the queue is stopped
+			if err := handleBarrier.AdvanceContext(mq.stopCtx); err != nil {
+				close(mq.data)
+				return
+			}
 			go handle(mq, &msg)
 		}
 	}
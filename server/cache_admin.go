@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/leopoldxx/go-utils/cache"
+	"github.com/leopoldxx/go-utils/middleware"
+	"github.com/leopoldxx/go-utils/server/reply"
+)
+
+// DefaultCacheAdminPrefix is the pprof style path prefix of the cache admin api
+const DefaultCacheAdminPrefix = "/debug/caches"
+
+// CacheAdmin is a controller to inspect and flush the named caches:
+//
+//	GET    {prefix}                      list the caches with stats
+//	GET    {prefix}/{name}               stats of the cache
+//	DELETE {prefix}/{name}               flush the cache
+//	GET    {prefix}/{name}/keys/{key}    look up the key
+//	DELETE {prefix}/{name}/keys/{key}    delete the key
+//	DELETE {prefix}/{name}/tags/{tag}    invalidate the tag
+//
+// only the string keys can be looked up or deleted
+type CacheAdmin struct {
+	prefix string
+
+	sync.RWMutex
+	caches map[string]cache.Cache
+}
+
+// NewCacheAdmin will create a cache admin controller, DefaultCacheAdminPrefix
+// is used if the prefix is empty
+func NewCacheAdmin(prefix string) *CacheAdmin {
+	if len(prefix) == 0 {
+		prefix = DefaultCacheAdminPrefix
+	}
+	return &CacheAdmin{
+		prefix: prefix,
+		caches: map[string]cache.Cache{},
+	}
+}
+
+// Add a named cache, the cache with the same name is replaced
+func (ca *CacheAdmin) Add(name string, c cache.Cache) {
+	ca.Lock()
+	defer ca.Unlock()
+	ca.caches[name] = c
+}
+
+// Remove the named cache
+func (ca *CacheAdmin) Remove(name string) {
+	ca.Lock()
+	defer ca.Unlock()
+	delete(ca.caches, name)
+}
+
+// Register the cache admin api
+func (ca *CacheAdmin) Register(router *mux.Router) {
+	handle := func(path, method, name string, h http.HandlerFunc) {
+		router.Path(ca.prefix + path).Methods(method).HandlerFunc(middleware.RecoverWithTrace(name).HandlerFunc(h))
+	}
+	handle("", "GET", "cacheadmin-list", ca.list)
+	handle("/{name}", "GET", "cacheadmin-stats", ca.stats)
+	handle("/{name}", "DELETE", "cacheadmin-flush", ca.flush)
+	handle("/{name}/keys/{key:.+}", "GET", "cacheadmin-get", ca.get)
+	handle("/{name}/keys/{key:.+}", "DELETE", "cacheadmin-del", ca.del)
+	handle("/{name}/tags/{tag:.+}", "DELETE", "cacheadmin-invalidate", ca.invalidate)
+}
+
+type cacheStats struct {
+	Name           string           `json:"name"`
+	Len            int              `json:"len"`
+	Cost           int64            `json:"cost"`
+	Hits           int64            `json:"hits"`
+	Misses         int64            `json:"misses"`
+	HitRatio       float64          `json:"hitRatio"`
+	WindowHitRatio float64          `json:"windowHitRatio"`
+	Evictions      map[string]int64 `json:"evictions"`
+}
+
+func newCacheStats(name string, c cache.Cache) cacheStats {
+	s := c.Stats()
+	cs := cacheStats{
+		Name:           name,
+		Len:            s.Len,
+		Cost:           s.Cost,
+		Hits:           s.Hits,
+		Misses:         s.Misses,
+		HitRatio:       s.HitRatio,
+		WindowHitRatio: s.WindowHitRatio,
+		Evictions:      map[string]int64{},
+	}
+	for reason, n := range s.Evictions {
+		cs.Evictions[reason.String()] = n
+	}
+	return cs
+}
+
+func (ca *CacheAdmin) lookup(w http.ResponseWriter, r *http.Request) (string, cache.Cache, bool) {
+	name := mux.Vars(r)["name"]
+	ca.RLock()
+	c, ok := ca.caches[name]
+	ca.RUnlock()
+	if !ok {
+		reply.ResourceNotFound(w, r, fmt.Sprintf("cache %s not found", name))
+	}
+	return name, c, ok
+}
+
+func (ca *CacheAdmin) list(w http.ResponseWriter, r *http.Request) {
+	ca.RLock()
+	stats := make([]cacheStats, 0, len(ca.caches))
+	for name, c := range ca.caches {
+		stats = append(stats, newCacheStats(name, c))
+	}
+	ca.RUnlock()
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	reply.Reply(w, r, http.StatusOK, stats)
+}
+
+func (ca *CacheAdmin) stats(w http.ResponseWriter, r *http.Request) {
+	if name, c, ok := ca.lookup(w, r); ok {
+		reply.Reply(w, r, http.StatusOK, newCacheStats(name, c))
+	}
+}
+
+func (ca *CacheAdmin) flush(w http.ResponseWriter, r *http.Request) {
+	name, c, ok := ca.lookup(w, r)
+	if !ok {
+		return
+	}
+	n := len(c.DelMulti(c.Keys()))
+	reply.OK(w, r, fmt.Sprintf("%d keys of cache %s are flushed", n, name))
+}
+
+func (ca *CacheAdmin) get(w http.ResponseWriter, r *http.Request) {
+	name, c, ok := ca.lookup(w, r)
+	if !ok {
+		return
+	}
+	key := mux.Vars(r)["key"]
+	// peek does not change the stats & the order of the cache
+	value, ok := c.Peek(key)
+	if !ok {
+		reply.ResourceNotFound(w, r, fmt.Sprintf("key %s of cache %s not found", key, name))
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	reply.Reply(w, r, http.StatusOK, struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}{key, data})
+}
+
+func (ca *CacheAdmin) del(w http.ResponseWriter, r *http.Request) {
+	name, c, ok := ca.lookup(w, r)
+	if !ok {
+		return
+	}
+	key := mux.Vars(r)["key"]
+	if _, ok := c.Peek(key); !ok {
+		reply.ResourceNotFound(w, r, fmt.Sprintf("key %s of cache %s not found", key, name))
+		return
+	}
+	c.Del(key)
+	reply.OK(w, r, fmt.Sprintf("key %s of cache %s is deleted", key, name))
+}
+
+func (ca *CacheAdmin) invalidate(w http.ResponseWriter, r *http.Request) {
+	name, c, ok := ca.lookup(w, r)
+	if !ok {
+		return
+	}
+	tag := mux.Vars(r)["tag"]
+	n := c.InvalidateTag(tag)
+	reply.OK(w, r, fmt.Sprintf("%d keys of tag %s in cache %s are invalidated", n, tag, name))
+}
@@ -0,0 +1,73 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leopoldxx/go-utils/cache"
+	. "github.com/leopoldxx/go-utils/server"
+)
+
+func TestCacheAdmin(t *testing.T) {
+	users, orders := cache.NewCache(), cache.NewCache()
+	defer users.Close()
+	defer orders.Close()
+	users.Put("user/1", map[string]string{"name": "alice"})
+	users.Put("user/2", map[string]string{"name": "bob"})
+	orders.PutWithTags("order1", 100, time.Minute, "user/1")
+	orders.PutWithTags("order2", 200, time.Minute, "user/1")
+	orders.Put("order3", 300)
+
+	admin := NewCacheAdmin("")
+	admin.Add("users", users)
+	admin.Add("orders", orders)
+	s := New(APIPrefix("/api"), PProf(true), DebugController(admin))
+
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, "http://example.com"+target, nil))
+		return w
+	}
+
+	testCases := []struct {
+		method     string
+		target     string
+		expectCode int
+		expectBody string
+	}{
+		{"GET", "/debug/caches", 200, `"name":"orders","len":3`},
+		{"GET", "/debug/caches/users", 200, `"name":"users","len":2`},
+		{"GET", "/debug/caches/nothing", 404, "cache nothing not found"},
+		{"GET", "/debug/caches/users/keys/user/1", 200, `"value":{"name":"alice"}`},
+		{"GET", "/debug/caches/users/keys/user/3", 404, "key user/3 of cache users not found"},
+		{"DELETE", "/debug/caches/users/keys/user/1", 200, "key user/1 of cache users is deleted"},
+		{"DELETE", "/debug/caches/users/keys/user/1", 404, "key user/1 of cache users not found"},
+		{"DELETE", "/debug/caches/orders/tags/user/1", 200, "2 keys of tag user/1 in cache orders are invalidated"},
+		{"DELETE", "/debug/caches/users", 200, "1 keys of cache users are flushed"},
+		{"GET", "/debug/caches", 200, `"name":"users","len":0`},
+	}
+	for idx, tc := range testCases {
+		w := do(tc.method, tc.target)
+		if w.Code != tc.expectCode || !strings.Contains(w.Body.String(), tc.expectBody) {
+			t.Fatalf("test case %d failed, expect %d %s, got %d %s", idx, tc.expectCode, tc.expectBody, w.Code, w.Body.String())
+		}
+	}
+
+	var stats []struct {
+		Name string `json:"name"`
+		Len  int    `json:"len"`
+	}
+	if err := json.Unmarshal(do("GET", "/debug/caches").Body.Bytes(), &stats); err != nil || len(stats) != 2 || stats[0].Len != 1 {
+		t.Fatalf("list caches failed, got %v, %v", stats, err)
+	}
+
+	// the debug controllers are not registered if pprof is off
+	s = New(DebugController(admin))
+	if w := do("GET", "/debug/caches"); w.Code != http.StatusNotFound {
+		t.Fatalf("debug controller should not be registered, got %d", w.Code)
+	}
+}
@@ -28,6 +28,7 @@ type options struct {
 	listenAddr      string
 	prefix          string
 	debug           bool
+	debugCtrls      []Controller
 	notfoundHandler http.Handler
 }
 
@@ -55,6 +56,14 @@ func PProf(d bool) Option {
 	}
 }
 
+// DebugController registers the controllers beside the pprof api, they are
+// not under the api prefix and only registered if the pprof api is on
+func DebugController(ctrls ...Controller) Option {
+	return func(opts *options) {
+		opts.debugCtrls = append(opts.debugCtrls, ctrls...)
+	}
+}
+
 // WithNotFoundHandler set NotFoundHandler for router
 func WithNotFoundHandler(h http.Handler) Option {
 	return func(opts *options) {
@@ -94,6 +103,9 @@ func New(ops ...Option) Server {
 
 	if opts.debug == true {
 		debug(s.rrouter)
+		for _, ctrl := range opts.debugCtrls {
+			ctrl.Register(s.rrouter)
+		}
 	}
 
 	if opts.notfoundHandler != nil {